@@ -2,9 +2,11 @@ package amper
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/crypto/openpgp"
 )
 
 type Kernel struct {
@@ -13,46 +15,146 @@ type Kernel struct {
 	containers      map[string]*Container
 	policyTemplates map[string]*PolicyTemplate
 	accounts        map[string]*Account
+	accountsByID    map[string]*Account
+	accountsByShort map[string]*Account
+	partials        map[string]*Partial
+	accountGroups   map[string]*AccountGroup
+	guardrails      []*Guardrail
 
-	StateBucket string
-	S3          *s3.S3
+	TemplateSource TemplateSource
+
+	// KeyFormats is the ordered list of key formats used for locating
+	// templates in TemplateSource. First format, which resolves
+	// to existing template, wins.
+	KeyFormats []string
+
+	// Keyring is used for verifying signatures of fetched templates.
+	Keyring openpgp.KeyRing
+
+	// RequireSignature requires all fetched templates to be signed.
+	RequireSignature bool
+
+	// MissingKeyError makes rendering fail, if template refers
+	// to key, which is not set, instead of rendering "<no value>".
+	MissingKeyError bool
 
-	KeyFormat string
+	// SandboxFuncs removes functions, which read environment or
+	// are not deterministic, from templates, see sandboxedFuncs.
+	SandboxFuncs bool
+
+	// RoleNameFormat is the format of container's role name,
+	// with same named placeholders as in KeyFormats, except {key}.
+	// DefaultRoleNameFormat is used, if empty.
+	RoleNameFormat string
 }
 
 type AmperConfig struct {
+	// TemplateSource is used for fetching templates, which are not
+	// defined inline. If it's nil and S3 is set, templates are
+	// fetched from StateBucket.
+	TemplateSource TemplateSource
+
 	S3          *s3.S3
 	StateBucket string
-	KeyFormat   string
+
+	// KeyFormat is used, when KeyFormats is empty.
+	KeyFormat  string
+	KeyFormats []string
+
+	Keyring          openpgp.KeyRing
+	RequireSignature bool
+
+	MissingKeyError bool
+	SandboxFuncs    bool
+	RoleNameFormat  string
+
+	// Guardrails are applied to every container, see Kernel.AddGuardrail.
+	Guardrails []*Guardrail
 }
 
 type AccountLimits struct {
-	ManagedPolicySize      int
-	ManagedPoliciesPerRole int
+	ManagedPolicySize      int `yaml:"managed_policy_size"`
+	ManagedPoliciesPerRole int `yaml:"managed_policies_per_role"`
 }
 
 type Account struct {
-	ID        string
-	Name      string
-	ShortName string
+	ID        string `yaml:"id"`
+	Name      string `yaml:"name"`
+	ShortName string `yaml:"short_name"`
+
+	Limits AccountLimits `yaml:"limits"`
+
+	// Groups contains names of account groups, which account joins.
+	Groups []string `yaml:"groups"`
+
+	// Environment is the tier of account, like prod or sandbox.
+	Environment string `yaml:"environment"`
+
+	// Partition is AWS partition of account, DefaultPartition if empty.
+	Partition string `yaml:"partition"`
 
-	Limits AccountLimits
+	// Regions contains allowed regions of account, see
+	// Container.DenyOtherRegions.
+	Regions []string          `yaml:"regions"`
+	Email   string            `yaml:"email"`
+	Tags    map[string]string `yaml:"tags"`
 }
 
-func NewKernel(config *AmperConfig) *Kernel {
+// PartitionName returns partition of account.
+func (account *Account) PartitionName() string {
+	if account.Partition == "" {
+		return DefaultPartition
+	}
+
+	return account.Partition
+}
+
+// NewKernel creates kernel from config. Key formats are validated,
+// see ValidateKeyFormat.
+func NewKernel(config *AmperConfig) (*Kernel, error) {
 	k := &Kernel{
 		containers:      make(map[string]*Container),
 		policyTemplates: make(map[string]*PolicyTemplate),
 		accounts:        make(map[string]*Account),
+		accountsByID:    make(map[string]*Account),
+		accountsByShort: make(map[string]*Account),
+		partials:        make(map[string]*Partial),
+		accountGroups:   make(map[string]*AccountGroup),
+
+		TemplateSource: config.TemplateSource,
+		KeyFormats:     config.KeyFormats,
 
-		S3:          config.S3,
-		StateBucket: config.StateBucket,
-		KeyFormat:   config.KeyFormat,
+		Keyring:          config.Keyring,
+		RequireSignature: config.RequireSignature,
+
+		MissingKeyError: config.MissingKeyError,
+		SandboxFuncs:    config.SandboxFuncs,
+		RoleNameFormat:  config.RoleNameFormat,
+	}
+
+	if len(k.KeyFormats) == 0 && config.KeyFormat != "" {
+		k.KeyFormats = []string{config.KeyFormat}
+	}
+
+	for _, format := range k.KeyFormats {
+		if err := ValidateKeyFormat(format); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, g := range config.Guardrails {
+		if err := k.AddGuardrail(g); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.TemplateSource == nil && config.S3 != nil && config.StateBucket != "" {
+		k.TemplateSource = NewS3TemplateSource(config.S3, config.StateBucket)
 	}
 
 	k.NewContainer("") // null container
 
-	return k
+	return k, nil
 }
 
 func (a *Kernel) NewContainer(id string) (*Container, error) {
@@ -77,12 +179,50 @@ func (a *Kernel) AddAccount(account *Account) error {
 	a.Lock()
 	defer a.Unlock()
 
+	if account.Name == "" {
+		return fmt.Errorf("account name is not set")
+	}
+
 	if _, ok := a.accounts[account.Name]; ok {
 		return fmt.Errorf("account '%s' already exists", account.Name)
 	}
 
+	// Name, ID and short name of account must not refer
+	// to any other account.
+	for _, key := range []string{account.Name, account.ID, account.ShortName} {
+		if key == "" {
+			continue
+		}
+
+		if other, ok := a.findAccount(key); ok {
+			return fmt.Errorf("account '%s' conflicts with account '%s', both are referred by '%s'", account.Name, other.Name, key)
+		}
+	}
+
+	if account.Partition != "" && !isPartition(account.Partition) {
+		return fmt.Errorf("unknown partition '%s' of account '%s'", account.Partition, account.Name)
+	}
+
+	if account.Limits.ManagedPolicySize < 0 || account.Limits.ManagedPoliciesPerRole < 0 {
+		return fmt.Errorf("invalid limits of account '%s'", account.Name)
+	}
+
+	for _, group := range account.Groups {
+		if _, ok := a.accountGroups[group]; ok {
+			return fmt.Errorf("account '%s' cannot join account group '%s', members of group are already resolved", account.Name, group)
+		}
+	}
+
 	a.accounts[account.Name] = account
 
+	if account.ID != "" {
+		a.accountsByID[account.ID] = account
+	}
+
+	if account.ShortName != "" {
+		a.accountsByShort[account.ShortName] = account
+	}
+
 	if account.Limits.ManagedPolicySize == 0 {
 		account.Limits.ManagedPolicySize = DefaultManagedPolicySize
 	}
@@ -94,6 +234,26 @@ func (a *Kernel) AddAccount(account *Account) error {
 	return nil
 }
 
+// findAccount returns account by name, ID or short name.
+// Kernel must be locked.
+func (a *Kernel) findAccount(key string) (*Account, bool) {
+	for _, accounts := range []map[string]*Account{a.accounts, a.accountsByID, a.accountsByShort} {
+		if account, ok := accounts[key]; ok {
+			return account, true
+		}
+	}
+
+	return nil, false
+}
+
+// LookupAccount returns account by name, ID or short name.
+func (a *Kernel) LookupAccount(key string) (*Account, bool) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.findAccount(key)
+}
+
 func (a *Kernel) AddPolicyTemplate(containerID string, pt *PolicyTemplate) error {
 	a.Lock()
 
@@ -111,3 +271,80 @@ func (a *Kernel) AddPolicyTemplate(containerID string, pt *PolicyTemplate) error
 
 	return c.AddPolicyTemplate(pt)
 }
+
+// DiscoverPolicyTemplates lists templates of container in TemplateSource
+// and registers all templates, which are not registered yet. IDs, by
+// which discovered templates can be attached, are returned: the key, or
+// qualified ID (see PolicyTemplateID), if key is taken by template of
+// other container.
+func (a *Kernel) DiscoverPolicyTemplates(containerID string) ([]string, error) {
+	if containerID == "" {
+		return nil, fmt.Errorf("cannot discover policy templates of null container")
+	}
+
+	if a.TemplateSource == nil || len(a.KeyFormats) == 0 {
+		return nil, fmt.Errorf("template source configuration not found")
+	}
+
+	a.RLock()
+	c, ok := a.containers[containerID]
+	a.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("container '%s' not found", containerID)
+	}
+
+	found := make(map[string]bool)
+
+	for _, format := range a.KeyFormats {
+		prefix, re := keyFormatMatcher(format, containerID)
+
+		// Template key is captured by the first group.
+		if re == nil || re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("invalid key format '%s'", format)
+		}
+
+		keys, err := a.TemplateSource.List(prefix)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if m := re.FindStringSubmatch(key); m != nil {
+				found[m[1]] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+
+	for key := range found {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	a.Lock()
+	defer a.Unlock()
+
+	res := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		id := PolicyTemplateID(containerID, key)
+
+		if _, ok := a.policyTemplates[id]; !ok {
+			if err := c.addPolicyTemplate(&PolicyTemplate{Key: key}); err != nil {
+				return nil, err
+			}
+		}
+
+		if a.policyTemplates[key].container != c {
+			key = id
+		}
+
+		res = append(res, key)
+	}
+
+	return res, nil
+}
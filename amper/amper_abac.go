@@ -0,0 +1,139 @@
+package amper
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ABAC scopes Allow statements of container to resources tagged with
+// container's tag, see ABACActions.
+type ABAC struct {
+	// TagKey is the key of the tag, like container.
+	TagKey string `yaml:"tag_key"`
+
+	// TagValue is the value of the tag, defaults to container ID.
+	TagValue string `yaml:"tag_value"`
+}
+
+// tagValue returns value of tag of container.
+func (c *Container) tagValue() string {
+	if c.ABAC.TagValue != "" {
+		return c.ABAC.TagValue
+	}
+
+	return c.ID
+}
+
+// abacWildcardError returns error, if wildcard action matches actions
+// from catalog, since such action can't be scoped by tags.
+func abacWildcardError(c *Container, s *IAMPolicyStatement, action string) error {
+	if !strings.ContainsAny(action, "*?") {
+		return nil
+	}
+
+	pattern := strings.ToLower(action)
+
+	for a := range ABACActions {
+		if ok, _ := path.Match(pattern, a); ok {
+			return fmt.Errorf("container '%s': action '%s' of statement '%s' matches taggable action '%s' and can't be scoped by tags, list actions explicitly", c.ID, action, s.Sid, a)
+		}
+	}
+
+	return nil
+}
+
+// applyABAC splits Allow statements of document into statements with
+// actions, which are not in catalog, and statements with actions, which
+// support aws:ResourceTag, aws:RequestTag or both, and adds tag conditions
+// to the latter. Wildcard actions, which match taggable actions, and
+// Allow statements with NotAction are errors, since they can't be scoped.
+func (c *Container) applyABAC(pd *IAMPolicyDoc) (err error) {
+	if c.ABAC == nil || pd == nil {
+		return nil
+	}
+
+	if c.ABAC.TagKey == "" {
+		return fmt.Errorf("container '%s': abac tag key is not set", c.ID)
+	}
+
+	var statements []*IAMPolicyStatement
+
+	for _, s := range pd.Statements {
+		if s.Effect != "Allow" {
+			statements = append(statements, s)
+			continue
+		}
+
+		if len(s.NotActions) > 0 {
+			return fmt.Errorf("container '%s': statement '%s' allows NotAction, which can't be scoped by tags", c.ID, s.Sid)
+		}
+
+		var untagged StringList
+		tagged := make(map[string]StringList)
+
+		for _, action := range s.Actions {
+			if keys, ok := ABACActions[strings.ToLower(action)]; ok {
+				key := strings.Join(keys, ",")
+				tagged[key] = append(tagged[key], action)
+				continue
+			}
+
+			if err = abacWildcardError(c, s, action); err != nil {
+				return err
+			}
+
+			untagged = append(untagged, action)
+		}
+
+		if len(tagged) == 0 {
+			statements = append(statements, s)
+			continue
+		}
+
+		keys := make([]string, 0, len(tagged))
+
+		for key := range tagged {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		// Statement keeps its Sid, if it's not split.
+		split := len(keys) > 1 || len(untagged) > 0
+
+		if len(untagged) > 0 {
+			ns := *s
+			ns.Actions = untagged
+			statements = append(statements, &ns)
+		}
+
+		for _, key := range keys {
+			ns := *s
+			ns.Actions = tagged[key]
+
+			for _, k := range strings.Split(key, ",") {
+				if split && ns.Sid != "" {
+					ns.Sid += strings.TrimPrefix(k, "aws:")
+				}
+
+				err = injectCondition(&ns, &InjectedCondition{
+					Operator: "StringEquals",
+					Key:      k + "/" + c.ABAC.TagKey,
+					Values:   StringList{c.tagValue()},
+				})
+
+				if err != nil {
+					return fmt.Errorf("container '%s': %s", c.ID, err)
+				}
+			}
+
+			statements = append(statements, &ns)
+		}
+	}
+
+	pd.Statements = statements
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package amper
+
+// Condition keys of tag-based access control.
+const (
+	ABACResourceTag = "aws:ResourceTag"
+	ABACRequestTag  = "aws:RequestTag"
+)
+
+var (
+	resourceTag           = []string{ABACResourceTag}
+	requestTag            = []string{ABACRequestTag}
+	resourceAndRequestTag = []string{ABACResourceTag, ABACRequestTag}
+)
+
+// ABACActions is offline catalog of actions, which support tag conditions,
+// indexed by lower-case action name. Value contains condition keys, which
+// scope action: aws:ResourceTag for actions on existing resources,
+// aws:RequestTag for actions, which create tagged resources, and both
+// for actions, which create or tag resources from existing ones. Actions,
+// which are not in catalog, are never scoped. Catalog can be extended
+// before rendering.
+var ABACActions = map[string][]string{
+	// EC2
+	"ec2:startinstances":          resourceTag,
+	"ec2:stopinstances":           resourceTag,
+	"ec2:rebootinstances":         resourceTag,
+	"ec2:terminateinstances":      resourceTag,
+	"ec2:modifyinstanceattribute": resourceTag,
+	"ec2:attachvolume":            resourceTag,
+	"ec2:detachvolume":            resourceTag,
+	"ec2:deletevolume":            resourceTag,
+	"ec2:deletesnapshot":          resourceTag,
+	"ec2:deletesecuritygroup":     resourceTag,
+	"ec2:createvolume":            requestTag,
+	"ec2:createsnapshot":          resourceAndRequestTag,
+	"ec2:createtags":              resourceAndRequestTag,
+	"ec2:createsecuritygroup":     requestTag,
+
+	// Lambda
+	"lambda:invokefunction":              resourceTag,
+	"lambda:updatefunctioncode":          resourceTag,
+	"lambda:updatefunctionconfiguration": resourceTag,
+	"lambda:deletefunction":              resourceTag,
+	"lambda:getfunction":                 resourceTag,
+	"lambda:createfunction":              requestTag,
+	"lambda:tagresource":                 resourceAndRequestTag,
+
+	// DynamoDB
+	"dynamodb:getitem":     resourceTag,
+	"dynamodb:putitem":     resourceTag,
+	"dynamodb:updateitem":  resourceTag,
+	"dynamodb:deleteitem":  resourceTag,
+	"dynamodb:query":       resourceTag,
+	"dynamodb:scan":        resourceTag,
+	"dynamodb:deletetable": resourceTag,
+	"dynamodb:createtable": requestTag,
+
+	// SQS
+	"sqs:sendmessage":    resourceTag,
+	"sqs:receivemessage": resourceTag,
+	"sqs:deletemessage":  resourceTag,
+	"sqs:purgequeue":     resourceTag,
+	"sqs:deletequeue":    resourceTag,
+	"sqs:createqueue":    requestTag,
+	"sqs:tagqueue":       resourceAndRequestTag,
+
+	// SNS
+	"sns:publish":     resourceTag,
+	"sns:subscribe":   resourceTag,
+	"sns:deletetopic": resourceTag,
+	"sns:createtopic": requestTag,
+	"sns:tagresource": resourceAndRequestTag,
+
+	// Secrets Manager
+	"secretsmanager:getsecretvalue": resourceTag,
+	"secretsmanager:putsecretvalue": resourceTag,
+	"secretsmanager:updatesecret":   resourceTag,
+	"secretsmanager:deletesecret":   resourceTag,
+	"secretsmanager:createsecret":   requestTag,
+	"secretsmanager:tagresource":    resourceAndRequestTag,
+
+	// SSM, PutParameter creates parameters, overwriting parameters is
+	// not allowed, since tags can't be passed with Overwrite.
+	"ssm:getparameter":    resourceTag,
+	"ssm:getparameters":   resourceTag,
+	"ssm:deleteparameter": resourceTag,
+	"ssm:putparameter":    requestTag,
+
+	// KMS
+	"kms:encrypt":         resourceTag,
+	"kms:decrypt":         resourceTag,
+	"kms:generatedatakey": resourceTag,
+	"kms:describekey":     resourceTag,
+	"kms:createkey":       requestTag,
+
+	// CloudWatch Logs, actions on log streams don't support tags.
+	"logs:deleteloggroup": resourceTag,
+	"logs:createloggroup": requestTag,
+
+	// Step Functions
+	"states:startexecution":     resourceTag,
+	"states:updatestatemachine": resourceTag,
+	"states:deletestatemachine": resourceTag,
+	"states:createstatemachine": requestTag,
+}
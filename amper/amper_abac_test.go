@@ -0,0 +1,162 @@
+package amper
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestABAC(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "111111111111", Name: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.ABAC = &ABAC{TagKey: "container"}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:   "t",
+		Scope: []string{"sqs:*", "s3:*"},
+		Template: aws.String(`{"Statement": [
+  {"Sid": "Queue", "Effect": "Allow", "Action": ["sqs:SendMessage", "sqs:CreateQueue", "sqs:ListQueues"], "Resource": "*"},
+  {"Sid": "Send", "Effect": "Allow", "Action": "sqs:SendMessage", "Resource": "*"},
+  {"Sid": "S3", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"},
+  {"Sid": "Deny", "Effect": "Deny", "Action": "sqs:DeleteQueue", "Resource": "*"}
+]}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.AddAttachment("t", "prod", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sids := make(map[string]*IAMPolicyStatement)
+
+	for _, s := range policy.AccountPolicies["prod"][0].Statements {
+		sids[s.Sid] = s
+	}
+
+	expected := map[string]string{
+		"Queue":            "sqs:ListQueues",
+		"QueueRequestTag":  "sqs:CreateQueue aws:RequestTag/container=c1",
+		"QueueResourceTag": "sqs:SendMessage aws:ResourceTag/container=c1",
+		"Send":             "sqs:SendMessage aws:ResourceTag/container=c1",
+		"S3":               "s3:GetObject",
+		"Deny":             "sqs:DeleteQueue",
+		"AllowAll":         "*",
+	}
+
+	for sid, e := range expected {
+		s, ok := sids[sid]
+
+		if !ok {
+			t.Fatalf("statement '%s' not found", sid)
+		}
+
+		res := strings.Join(s.Actions, ",")
+
+		for key, values := range s.Conditions["StringEquals"] {
+			res += " " + key + "=" + strings.Join(values, ",")
+		}
+
+		if res != e {
+			t.Fatalf("unexpected statement '%s', expected '%s', got '%s'", sid, e, res)
+		}
+	}
+
+	if len(policy.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", policy.Warnings)
+	}
+
+	for _, test := range []struct {
+		s   *IAMPolicyStatement
+		err string
+	}{
+		{&IAMPolicyStatement{Sid: "Any", Effect: "Allow", Actions: StringList{"sqs:*"}}, "action 'sqs:*' of statement 'Any' matches taggable action"},
+		{&IAMPolicyStatement{Sid: "Not", Effect: "Allow", NotActions: StringList{"iam:*"}}, "statement 'Not' allows NotAction"},
+	} {
+		if err = c.applyABAC(&IAMPolicyDoc{Statements: []*IAMPolicyStatement{test.s}}); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error containing '%s', got %v", test.err, err)
+		}
+	}
+
+	// Wildcards, which don't match taggable actions, are not scoped.
+	if err = c.applyABAC(&IAMPolicyDoc{Statements: []*IAMPolicyStatement{{Sid: "List", Effect: "Allow", Actions: StringList{"sqs:List*"}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.ABAC.TagValue = "team-a"
+
+	pd := &IAMPolicyDoc{Statements: []*IAMPolicyStatement{
+		{Sid: "Send", Effect: "Allow", Actions: StringList{"sqs:SendMessage"}, Conditions: map[string]map[string]StringList{"StringEquals": {"aws:ResourceTag/container": {"team-b"}}}},
+	}}
+
+	if err = c.applyABAC(pd); err == nil || !strings.Contains(err.Error(), "no values in common") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
+
+func TestABACCatalog(t *testing.T) {
+	c := &Container{ID: "c1", ABAC: &ABAC{TagKey: "container"}}
+
+	for _, test := range []struct {
+		action string
+		key    string
+	}{
+		{"ssm:GetParameter", ABACResourceTag},
+		{"logs:DeleteLogGroup", ABACResourceTag},
+		{"ssm:PutParameter", ABACRequestTag},
+		{"logs:CreateLogGroup", ABACRequestTag},
+		{"sqs:TagQueue", ABACRequestTag + "/container," + ABACResourceTag},
+		{"logs:CreateLogStream", ""},
+		{"logs:PutLogEvents", ""},
+	} {
+		pd := &IAMPolicyDoc{Statements: []*IAMPolicyStatement{
+			{Sid: "Test", Effect: "Allow", Actions: StringList{test.action}, Resources: StringList{"*"}},
+		}}
+
+		if err := c.applyABAC(pd); err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []string
+
+		for key := range pd.Statements[0].Conditions["StringEquals"] {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		expected := ""
+
+		if test.key != "" {
+			expected = test.key + "/container"
+		}
+
+		if res := strings.Join(keys, ","); len(pd.Statements) != 1 || res != expected {
+			t.Fatalf("unexpected condition of action '%s', expected '%s', got '%s'", test.action, expected, res)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package amper
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// AccountGroup is named set of accounts, which can be used as target
+// of attachments. Accounts can also join groups by Account.Groups.
+// Members of group are resolved, when group is registered, so accounts
+// must be added before their groups.
+type AccountGroup struct {
+	Name string `yaml:"name"`
+
+	// Accounts contains names or glob patterns of account names,
+	// see path.Match for syntax.
+	Accounts []string `yaml:"accounts"`
+
+	members map[string]*Account
+}
+
+// IsAccountPattern checks, if account name is glob pattern.
+func IsAccountPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// AddAccountGroup registers account group in kernel and resolves its
+// members. Names, which don't refer to any account, are errors.
+func (a *Kernel) AddAccountGroup(g *AccountGroup) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if g.Name == "" {
+		return fmt.Errorf("account group name is not set")
+	}
+
+	if _, ok := a.accountGroups[g.Name]; ok {
+		return fmt.Errorf("account group '%s' already exists", g.Name)
+	}
+
+	members := make(map[string]*Account)
+
+	for _, pattern := range g.Accounts {
+		if !IsAccountPattern(pattern) {
+			account, ok := a.findAccount(pattern)
+
+			if !ok {
+				return fmt.Errorf("unknown account '%s' in account group '%s'", pattern, g.Name)
+			}
+
+			members[account.Name] = account
+			continue
+		}
+
+		accounts, err := a.matchAccounts(pattern)
+
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s' in account group '%s': %s", pattern, g.Name, err)
+		}
+
+		for name, account := range accounts {
+			members[name] = account
+		}
+	}
+
+	for name, account := range a.accounts {
+		for _, group := range account.Groups {
+			if group == g.Name {
+				members[name] = account
+			}
+		}
+	}
+
+	g.members = members
+	a.accountGroups[g.Name] = g
+
+	return nil
+}
+
+// Members returns sorted names of accounts of group.
+func (g *AccountGroup) Members() []string {
+	names := make([]string, 0, len(g.members))
+
+	for name := range g.members {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// matchAccounts returns accounts, which names match glob pattern.
+// Kernel must be locked.
+func (a *Kernel) matchAccounts(pattern string) (map[string]*Account, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid account pattern '%s': %s", pattern, err)
+	}
+
+	res := make(map[string]*Account)
+
+	for name, account := range a.accounts {
+		ok, err := path.Match(pattern, name)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid account pattern '%s': %s", pattern, err)
+		}
+
+		if ok {
+			res[name] = account
+		}
+	}
+
+	return res, nil
+}
+
+// groupAccounts returns resolved accounts of group. Kernel must be locked.
+func (a *Kernel) groupAccounts(group string) (map[string]*Account, error) {
+	g, ok := a.accountGroups[group]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown account group '%s'", group)
+	}
+
+	return g.members, nil
+}
+
+// AddAttachments attaches policy template to all accounts, which names
+// match glob pattern, or to all accounts of group, if group is set.
+// Attachments are added in order of account names. Pattern without
+// wildcards is the same as AddAttachment.
+func (c *Container) AddAttachments(policyTemplateID, pattern, group string, vars map[string]interface{}) ([]*Attachment, error) {
+	if (pattern == "") == (group == "") {
+		return nil, fmt.Errorf("cannot add attachment of '%s' in container '%s', either account pattern or group must be set", policyTemplateID, c.ID)
+	}
+
+	if group == "" && !IsAccountPattern(pattern) {
+		a, err := c.AddAttachment(policyTemplateID, pattern, vars)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Attachment{a}, nil
+	}
+
+	var (
+		accounts map[string]*Account
+		err      error
+	)
+
+	c.amper.RLock()
+
+	if group != "" {
+		accounts, err = c.amper.groupAccounts(group)
+	} else {
+		accounts, err = c.amper.matchAccounts(pattern)
+	}
+
+	c.amper.RUnlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot add attachment of '%s' in container '%s': %s", policyTemplateID, c.ID, err)
+	}
+
+	if len(accounts) == 0 && group == "" {
+		return nil, fmt.Errorf("cannot add attachment of '%s' in container '%s', no accounts match '%s'", policyTemplateID, c.ID, pattern)
+	}
+
+	names := make([]string, 0, len(accounts))
+
+	for name := range accounts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	res := make([]*Attachment, 0, len(names))
+
+	for _, name := range names {
+		a, err := c.AddAttachment(policyTemplateID, name, vars)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, a)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,115 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestAccountGroups(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acc := range []*Account{
+		{ID: "111111111111", Name: "prod-eu"},
+		{ID: "222222222222", Name: "prod-us"},
+		{ID: "333333333333", Name: "dev", Groups: []string{"sandbox"}},
+		{ID: "444444444444", Name: "playground", Groups: []string{"sandbox", "prod"}},
+	} {
+		if err := amper.AddAccount(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prod := &AccountGroup{Name: "prod", Accounts: []string{"prod-*", "prod-eu"}}
+
+	for _, g := range []*AccountGroup{prod, {Name: "sandbox"}} {
+		if err := amper.AddAccountGroup(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if res := strings.Join(prod.Members(), ","); res != "playground,prod-eu,prod-us" {
+		t.Fatalf("unexpected members of group 'prod': %s", res)
+	}
+
+	for _, test := range []struct {
+		g   *AccountGroup
+		err string
+	}{
+		{&AccountGroup{Name: "broken", Accounts: []string{"["}}, "invalid pattern"},
+		{&AccountGroup{Name: "missing", Accounts: []string{"qa"}}, "unknown account 'qa' in account group 'missing'"},
+	} {
+		if err := amper.AddAccountGroup(test.g); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error containing '%s', got %v", test.err, err)
+		}
+	}
+
+	// Members of groups are resolved, so accounts can't join them later.
+	if err := amper.AddAccount(&Account{ID: "555555555555", Name: "prod-ap"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "666666666666", Name: "qa", Groups: []string{"sandbox"}}); err == nil || !strings.Contains(err.Error(), "already resolved") {
+		t.Fatalf("expected resolved group error, got %v", err)
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:      "t",
+		Scope:    []string{"s3:*"},
+		Template: aws.String(`{"Statement": []}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		pattern, group string
+		accounts       []string
+	}{
+		{"", "prod", []string{"playground", "prod-eu", "prod-us"}},
+		{"", "sandbox", []string{"dev", "playground"}},
+		{"*-us", "", []string{"prod-us"}},
+		{"dev", "", []string{"dev"}},
+	} {
+		attachments, err := c.AddAttachments("t", test.pattern, test.group, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+
+		for _, a := range attachments {
+			names = append(names, a.account.Name)
+		}
+
+		if strings.Join(names, ",") != strings.Join(test.accounts, ",") {
+			t.Fatalf("expected accounts %v for '%s%s', got %v", test.accounts, test.pattern, test.group, names)
+		}
+	}
+
+	for _, test := range []struct {
+		pattern, group, err string
+	}{
+		{"", "unknown", "unknown account group 'unknown'"},
+		{"qa-*", "", "no accounts match 'qa-*'"},
+		{"qa", "", "unknown account 'qa'"},
+		{"prod-*", "prod", "either account pattern or group must be set"},
+	} {
+		if _, err = c.AddAttachments("t", test.pattern, test.group, nil); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error containing '%s', got %v", test.err, err)
+		}
+	}
+}
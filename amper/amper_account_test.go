@@ -0,0 +1,231 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestAccountAttributes(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "1", Name: "cn", Partition: "aws-xx"}); err == nil || !strings.Contains(err.Error(), "unknown partition 'aws-xx'") {
+		t.Fatalf("expected unknown partition error, got %v", err)
+	}
+
+	account := &Account{
+		ID:          "111111111111",
+		Name:        "prod",
+		Environment: "production",
+		Partition:   "aws-us-gov",
+		Regions:     []string{"us-gov-west-1", "us-gov-east-1"},
+		Email:       "prod@example.com",
+		Tags:        map[string]string{"team": "platform"},
+		Limits:      AccountLimits{ManagedPoliciesPerRole: 20},
+	}
+
+	if err := amper.AddAccount(account); err != nil {
+		t.Fatal(err)
+	}
+
+	if account.Limits.ManagedPolicySize != DefaultManagedPolicySize || account.Limits.ManagedPoliciesPerRole != 20 {
+		t.Fatalf("unexpected limits %+v", account.Limits)
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:   "attrs",
+		Scope: []string{"s3:*"},
+		Template: aws.String(`{"Statement": [{
+  "Sid": "{{ .account.Tags.team }}",
+  "Effect": "Allow",
+  "Action": "s3:*",
+  "Resource": [
+    "{{ .account.Environment }}",
+    "{{ .account.Partition }}",
+    "{{ index .account.Regions 1 }}",
+    "{{ .account.Email }}",
+    "{{ .account.Limits.ManagedPoliciesPerRole }}"
+  ]
+}]}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.AddAttachment("attrs", "prod", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := policy.AccountPolicies["prod"][0].Statements[0]
+
+	if s.Sid != "platform" || strings.Join(s.Resources, ",") != "production,aws-us-gov,us-gov-east-1,prod@example.com,20" {
+		t.Fatalf("unexpected statement %+v", s)
+	}
+}
+
+func TestAccountLookup(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "111111111111", Name: "prod", ShortName: "p"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		account *Account
+		err     string
+	}{
+		{&Account{ID: "111111111111", Name: "prod2", ShortName: "p2"}, "referred by '111111111111'"},
+		{&Account{ID: "222222222222", Name: "prod2", ShortName: "p"}, "referred by 'p'"},
+		{&Account{ID: "222222222222", Name: "p", ShortName: "p2"}, "referred by 'p'"},
+		{&Account{ID: "222222222222", Name: "prod", ShortName: "p2"}, "account 'prod' already exists"},
+	} {
+		if err := amper.AddAccount(test.account); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error containing '%s', got %v", test.err, err)
+		}
+	}
+
+	if err := amper.AddAccount(&Account{ID: "222222222222", Name: "dev", ShortName: "dev"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"prod", "111111111111", "p"} {
+		if a, ok := amper.LookupAccount(key); !ok || a.Name != "prod" {
+			t.Fatalf("expected to find account 'prod' by '%s'", key)
+		}
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:      "lookup",
+		Scope:    []string{"s3:*"},
+		Template: aws.String(`{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "{{ (account "222222222222").Name }}-{{ roleArn "dev" }}"}]}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.AddAttachment("lookup", "p", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := policy.AccountPolicies["prod"][0].Statements[0].Resources[0]; r != "dev-arn:aws:iam::222222222222:role/c1" {
+		t.Fatalf("unexpected resource '%s'", r)
+	}
+}
+
+func TestPartitionsAndRegions(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acc := range []*Account{
+		{ID: "111111111111", Name: "gov", Partition: "aws-us-gov", Regions: []string{"us-gov-west-1"}},
+		{ID: "222222222222", Name: "cn", Partition: "aws-cn"},
+		{ID: "333333333333", Name: "global", Regions: []string{"eu-west-1", "eu-central-1"}},
+	} {
+		if err := amper.AddAccount(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.DenyOtherRegions = true
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:      "arns",
+		Scope:    []string{"s3:*"},
+		Template: aws.String(`{"Statement": [{"Sid": "{{ partition | replace "-" "" }}", "Effect": "Allow", "Action": "s3:*", "Resource": ["{{ arn "s3" "b" }}", "{{ roleArn }}"]}]}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, account := range []string{"gov", "cn", "global"} {
+		if _, err = c.AddAttachment("arns", account, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for account, expected := range map[string]struct {
+		partition string
+		regions   []string
+	}{
+		"gov":    {"aws-us-gov", []string{"us-gov-west-1"}},
+		"cn":     {"aws-cn", nil},
+		"global": {"aws", []string{"eu-central-1", "eu-west-1"}},
+	} {
+		statements := policy.AccountPolicies[account][0].Statements
+		s := statements[0]
+
+		if s.Resources[0] != "arn:"+expected.partition+":s3:::b" || !strings.HasPrefix(s.Resources[1], "arn:"+expected.partition+":iam::") {
+			t.Fatalf("unexpected resources of account '%s': %v", account, s.Resources)
+		}
+
+		var deny *IAMPolicyStatement
+
+		for _, s := range statements {
+			if s.Sid == "DenyOtherRegions" {
+				deny = s
+			}
+		}
+
+		if expected.regions == nil {
+			if deny != nil {
+				t.Fatalf("unexpected region deny in account '%s'", account)
+			}
+			continue
+		}
+
+		if deny == nil || strings.Join(deny.Conditions["StringNotEquals"]["aws:RequestedRegion"], ",") != strings.Join(expected.regions, ",") {
+			t.Fatalf("unexpected region deny in account '%s': %+v", account, deny)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package amper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// InjectedCondition is condition, which is added to all Allow statements
+// of container, like aws:SourceVpce or aws:MultiFactorAuthPresent.
+type InjectedCondition struct {
+	// Operator is condition operator, like StringEquals.
+	Operator string `yaml:"operator"`
+
+	// Key is condition key, like aws:SourceVpce.
+	Key string `yaml:"key"`
+
+	Values StringList `yaml:"values"`
+
+	// Services limits injection to actions of any of services, like s3
+	// or ec2. Statements are split by services of their actions, so
+	// condition doesn't restrict actions of other services. Statements
+	// with "*" action or NotAction don't name service, so they never
+	// match services.
+	Services []string `yaml:"services"`
+}
+
+// matches checks, if condition must be injected into statement.
+func (ic *InjectedCondition) matches(s *IAMPolicyStatement) bool {
+	if s.Effect != "Allow" {
+		return false
+	}
+
+	if len(ic.Services) == 0 {
+		return true
+	}
+
+	for _, action := range s.Actions {
+		if ic.matchesAction(action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAction checks, if action belongs to any of services of condition.
+func (ic *InjectedCondition) matchesAction(action string) bool {
+	service := actionService(action)
+
+	if service == "" {
+		return false
+	}
+
+	for _, s := range ic.Services {
+		if strings.ToLower(s) == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// actionService returns lower-case service prefix of action.
+func actionService(action string) string {
+	if !strings.Contains(action, ":") {
+		return ""
+	}
+
+	return strings.ToLower(strings.SplitN(action, ":", 2)[0])
+}
+
+// exactConditionOperators are operators, for which values of same key
+// can be intersected, when statement already has condition on the key.
+var exactConditionOperators = map[string]bool{
+	"StringEquals":           true,
+	"StringEqualsIgnoreCase": true,
+	"NumericEquals":          true,
+	"DateEquals":             true,
+	"Bool":                   true,
+	"BinaryEquals":           true,
+	"ArnEquals":              true,
+	"Null":                   true,
+}
+
+// isExactConditionOperator checks, if operator matches exact values,
+// optionally with IfExists suffix or ForAllValues qualifier.
+func isExactConditionOperator(op string) bool {
+	op = strings.TrimPrefix(op, "ForAllValues:")
+	op = strings.TrimSuffix(op, "IfExists")
+
+	return exactConditionOperators[op]
+}
+
+// injectCondition adds condition to statement. If statement already
+// has condition on same key with same operator, both must hold, so
+// values are intersected for exact operators. Other conflicting
+// conditions can't be expressed in single statement and are
+// reported as errors.
+func injectCondition(s *IAMPolicyStatement, ic *InjectedCondition) error {
+	conditions := make(map[string]map[string]StringList, len(s.Conditions)+1)
+
+	for op, keys := range s.Conditions {
+		conditions[op] = make(map[string]StringList, len(keys))
+
+		for k, v := range keys {
+			conditions[op][k] = v
+		}
+	}
+
+	if conditions[ic.Operator] == nil {
+		conditions[ic.Operator] = make(map[string]StringList)
+	}
+
+	existing, ok := conditions[ic.Operator][ic.Key]
+
+	switch {
+	case !ok:
+		conditions[ic.Operator][ic.Key] = append(StringList{}, ic.Values...)
+	case sameValues(existing, ic.Values):
+	case isExactConditionOperator(ic.Operator):
+		values := intersectValues(existing, ic.Values)
+
+		if len(values) == 0 {
+			return fmt.Errorf("condition %s on '%s' of statement '%s' has no values in common with injected condition", ic.Operator, ic.Key, s.Sid)
+		}
+
+		conditions[ic.Operator][ic.Key] = values
+	default:
+		return fmt.Errorf("cannot inject condition %s on '%s' into statement '%s', it already has different condition on same key", ic.Operator, ic.Key, s.Sid)
+	}
+
+	s.Conditions = conditions
+
+	return nil
+}
+
+func sameValues(a, b StringList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append(StringList{}, a...)
+	b = append(StringList{}, b...)
+
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// intersectValues returns values of a, which are in b.
+func intersectValues(a, b StringList) StringList {
+	set := make(map[string]bool, len(b))
+
+	for _, v := range b {
+		set[v] = true
+	}
+
+	var res StringList
+
+	for _, v := range a {
+		if set[v] {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// injectConditions adds conditions of container to matching
+// statements of policy documents. Statements are split by services
+// first, see splitByServices.
+func (c *Container) injectConditions(docs []*IAMPolicyDoc) error {
+	for _, pd := range docs {
+		var statements []*IAMPolicyStatement
+
+		for _, s := range pd.Statements {
+			for _, ns := range c.splitByServices(s) {
+				for _, ic := range c.Conditions {
+					if !ic.matches(ns) {
+						continue
+					}
+
+					if err := injectCondition(ns, ic); err != nil {
+						return fmt.Errorf("container '%s': %s", c.ID, err)
+					}
+				}
+
+				statements = append(statements, ns)
+			}
+		}
+
+		pd.Statements = statements
+	}
+
+	return nil
+}
+
+// splitByServices splits Allow statement into statements, which actions
+// match same service-limited conditions of container. Statement keeps
+// its Sid for actions, which match no such condition, Sids of other
+// statements are suffixed with their services, like ListS3.
+func (c *Container) splitByServices(s *IAMPolicyStatement) []*IAMPolicyStatement {
+	if s.Effect != "Allow" || len(s.Actions) < 2 {
+		return []*IAMPolicyStatement{s}
+	}
+
+	var (
+		groups   []string
+		actions  = make(map[string]StringList)
+		services = make(map[string][]string)
+		seen     = make(map[string]bool)
+	)
+
+	for _, action := range s.Actions {
+		var matched []string
+
+		for i, ic := range c.Conditions {
+			if len(ic.Services) > 0 && ic.matchesAction(action) {
+				matched = append(matched, fmt.Sprintf("%d", i))
+			}
+		}
+
+		group := strings.Join(matched, ",")
+
+		if _, ok := actions[group]; !ok {
+			groups = append(groups, group)
+		}
+
+		actions[group] = append(actions[group], action)
+
+		if group == "" {
+			continue
+		}
+
+		service := actionService(action)
+
+		if !seen[group+"/"+service] {
+			seen[group+"/"+service] = true
+			services[group] = append(services[group], service)
+		}
+	}
+
+	if len(groups) == 1 {
+		return []*IAMPolicyStatement{s}
+	}
+
+	res := make([]*IAMPolicyStatement, 0, len(groups))
+
+	for _, group := range groups {
+		ns := *s
+		ns.Actions = actions[group]
+
+		if ns.Sid != "" {
+			for _, service := range services[group] {
+				ns.Sid += sidSuffix(service)
+			}
+		}
+
+		res = append(res, &ns)
+	}
+
+	return res
+}
+
+var sidSuffixRegexp = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// sidSuffix converts service name into alphanumeric suffix of Sid.
+func sidSuffix(service string) string {
+	var res string
+
+	for _, part := range sidSuffixRegexp.Split(service, -1) {
+		if part != "" {
+			res += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	return res
+}
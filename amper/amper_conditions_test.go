@@ -0,0 +1,136 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestInjectConditions(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "111111111111", Name: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Conditions = []*InjectedCondition{
+		{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: StringList{"true"}},
+		{Operator: "StringEquals", Key: "aws:SourceVpce", Values: StringList{"vpce-1", "vpce-2"}, Services: []string{"s3"}},
+	}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:   "t",
+		Scope: []string{"s3:*", "sqs:*"},
+		Template: aws.String(`{"Statement": [
+  {"Sid": "S3", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*",
+   "Condition": {"StringEquals": {"aws:SourceVpce": ["vpce-2", "vpce-3"]}, "Bool": {"aws:MultiFactorAuthPresent": "true"}}},
+  {"Sid": "Sqs", "Effect": "Allow", "Action": "sqs:SendMessage", "Resource": "*"},
+  {"Sid": "Deny", "Effect": "Deny", "Action": "s3:DeleteBucket", "Resource": "*"},
+  {"Sid": "Mixed", "Effect": "Allow", "Action": ["sqs:ReceiveMessage", "s3:ListBucket", "sqs:DeleteMessage"], "Resource": "*"}
+]}`),
+		ServiceRole: &ServiceRoleTemplate{
+			Name:               "worker",
+			Template:           aws.String(`{"Statement": [{"Sid": "Put", "Effect": "Allow", "Action": "s3:PutObject", "Resource": "*"}]}`),
+			AssumeRoleTemplate: aws.String(`{"Statement": [{"Effect": "Allow", "Action": "sts:AssumeRole", "Principal": {"Service": "lambda.amazonaws.com"}}]}`),
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.AddAttachment("t", "prod", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sids := make(map[string]*IAMPolicyStatement)
+
+	for _, s := range policy.AccountPolicies["prod"][0].Statements {
+		sids[s.Sid] = s
+	}
+
+	if s := sids["S3"]; strings.Join(s.Conditions["StringEquals"]["aws:SourceVpce"], ",") != "vpce-2" || s.Conditions["Bool"]["aws:MultiFactorAuthPresent"][0] != "true" {
+		t.Fatalf("unexpected conditions of S3 %+v", s.Conditions)
+	}
+
+	if s := sids["Sqs"]; len(s.Conditions) != 1 || s.Conditions["Bool"]["aws:MultiFactorAuthPresent"][0] != "true" {
+		t.Fatalf("unexpected conditions of Sqs %+v", s.Conditions)
+	}
+
+	if s := sids["Deny"]; len(s.Conditions) != 0 {
+		t.Fatalf("unexpected conditions of Deny %+v", s.Conditions)
+	}
+
+	// Multi-service statement is split, so s3 condition
+	// doesn't restrict sqs actions.
+	if s := sids["Mixed"]; strings.Join(s.Actions, ",") != "sqs:ReceiveMessage,sqs:DeleteMessage" || len(s.Conditions) != 1 {
+		t.Fatalf("unexpected Mixed statement %+v", s)
+	}
+
+	if s := sids["MixedS3"]; s == nil || strings.Join(s.Actions, ",") != "s3:ListBucket" || len(s.Conditions) != 2 {
+		t.Fatalf("unexpected MixedS3 statement %+v", s)
+	}
+
+	if s := policy.ServiceRolePolicies["prod"]["worker"].Policy.Statements[0]; len(s.Conditions) != 2 {
+		t.Fatalf("unexpected conditions of service role %+v", s.Conditions)
+	}
+
+	// Service-filtered conditions never go to AllowAll,
+	// since it doesn't name any service.
+	if s := sids["AllowAll"]; len(s.Conditions) != 1 || s.Conditions["Bool"] == nil {
+		t.Fatalf("unexpected conditions of AllowAll %+v", s.Conditions)
+	}
+
+	for _, s := range []*IAMPolicyStatement{
+		{Effect: "Allow", Actions: StringList{"*"}},
+		{Effect: "Allow", NotActions: StringList{"iam:*"}},
+		{Effect: "Allow", Actions: StringList{"sqs:*"}},
+	} {
+		if c.Conditions[1].matches(s) {
+			t.Fatalf("service-filtered condition must not match %+v", s)
+		}
+	}
+
+	if !c.Conditions[1].matches(&IAMPolicyStatement{Effect: "Allow", Actions: StringList{"sqs:*", "S3:Get*"}}) {
+		t.Fatalf("service-filtered condition must match statement with s3 action")
+	}
+
+	for _, test := range []struct {
+		existing map[string]map[string]StringList
+		err      string
+	}{
+		{map[string]map[string]StringList{"StringEquals": {"aws:SourceVpce": {"vpce-9"}}}, "has no values in common"},
+		{map[string]map[string]StringList{"StringLike": {"aws:SourceVpce": {"vpce-*"}}}, ""},
+	} {
+		s := &IAMPolicyStatement{Sid: "X", Effect: "Allow", Actions: StringList{"s3:*"}, Conditions: test.existing}
+
+		err := injectCondition(s, c.Conditions[1])
+
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Fatalf("expected error '%s', got %v", test.err, err)
+		}
+	}
+
+	s := &IAMPolicyStatement{Sid: "X", Effect: "Allow", Actions: StringList{"s3:*"}, Conditions: map[string]map[string]StringList{"StringLike": {"aws:SourceVpce": {"vpce-*"}}}}
+
+	if err = injectCondition(s, &InjectedCondition{Operator: "StringLike", Key: "aws:SourceVpce", Values: StringList{"vpce-1*"}}); err == nil || !strings.Contains(err.Error(), "different condition on same key") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package amper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is declarative model of kernel: accounts, partials, consts,
+// containers with their policy templates and attachments. It's decoded
+// from YAML or JSON document, see LoadConfig.
+type Config struct {
+	KeyFormats      []string `yaml:"key_formats"`
+	RoleNameFormat  string   `yaml:"role_name_format"`
+	MissingKeyError bool     `yaml:"missing_key_error"`
+	SandboxFuncs    bool     `yaml:"sandbox_funcs"`
+
+	// Templates are served by in-memory template source,
+	// indexed by key.
+	Templates map[string]string `yaml:"templates"`
+
+	// TemplateSource overrides in-memory template source.
+	TemplateSource TemplateSource `yaml:"-"`
+
+	// Consts are shared by all policy templates of config,
+	// consts of policy template override them.
+	Consts map[string]interface{} `yaml:"consts"`
+
+	// PolicyTemplates are added to null container, they can be
+	// attached in any container, but must be inline.
+	PolicyTemplates []*PolicyTemplateConfig `yaml:"policy_templates"`
+
+	Partials      []*Partial         `yaml:"partials"`
+	Accounts      []*Account         `yaml:"accounts"`
+	AccountGroups []*AccountGroup    `yaml:"account_groups"`
+	Containers    []*ContainerConfig `yaml:"containers"`
+
+	// Guardrails are kernel setting, they are applied to all containers.
+	Guardrails []*Guardrail `yaml:"guardrails"`
+}
+
+// ContainerConfig declares container with its policy templates
+// and attachments.
+type ContainerConfig struct {
+	ID                 string                  `yaml:"id"`
+	DenyOtherRegions   bool                    `yaml:"deny_other_regions"`
+	Conditions         []*InjectedCondition    `yaml:"conditions"`
+	ABAC               *ABAC                   `yaml:"abac"`
+	DisableDenyUnknown bool                    `yaml:"disable_deny_unknown"`
+	AllowListOnly      bool                    `yaml:"allow_list_only"`
+	ExcludeGuardrails  []string                `yaml:"exclude_guardrails"`
+	PolicyTemplates    []*PolicyTemplateConfig `yaml:"policy_templates"`
+	Attachments        []*AttachmentConfig     `yaml:"attachments"`
+}
+
+// PolicyTemplateConfig declares policy template, fields are
+// same as in PolicyTemplate and front-matter.
+type PolicyTemplateConfig struct {
+	Key         string                 `yaml:"key"`
+	Template    *string                `yaml:"template"`
+	Format      string                 `yaml:"format"`
+	VersionID   string                 `yaml:"version_id"`
+	SHA256      string                 `yaml:"sha256"`
+	Vars        []string               `yaml:"vars"`
+	Defaults    map[string]string      `yaml:"defaults"`
+	Variables   map[string]*Variable   `yaml:"variables"`
+	InferVars   bool                   `yaml:"infer_vars"`
+	Partials    []string               `yaml:"partials"`
+	Consts      map[string]interface{} `yaml:"consts"`
+	Scope       []string               `yaml:"scope"`
+	ServiceRole *ServiceRoleMeta       `yaml:"service_role"`
+}
+
+// AttachmentConfig attaches policy template to account, to accounts
+// matching glob pattern or to all accounts of group.
+type AttachmentConfig struct {
+	PolicyTemplate string                 `yaml:"policy_template"`
+	Account        string                 `yaml:"account"`
+	AccountGroup   string                 `yaml:"account_group"`
+	Vars           map[string]interface{} `yaml:"vars"`
+	VersionID      string                 `yaml:"version_id"`
+}
+
+// ParseConfig decodes YAML or JSON config.
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+
+	for k, v := range cfg.Consts {
+		cfg.Consts[k] = normalizeYAML(v)
+	}
+
+	for _, pt := range cfg.PolicyTemplates {
+		pt.normalize()
+	}
+
+	for _, c := range cfg.Containers {
+		for _, pt := range c.PolicyTemplates {
+			pt.normalize()
+		}
+
+		for _, a := range c.Attachments {
+			for k, v := range a.Vars {
+				a.Vars[k] = normalizeYAML(v)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// LoadConfig reads config from file.
+func LoadConfig(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := ParseConfig(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid config '%s': %s", file, err)
+	}
+
+	return cfg, nil
+}
+
+// NewKernel creates kernel with all declared objects.
+func (cfg *Config) NewKernel() (*Kernel, error) {
+	ac := &AmperConfig{
+		KeyFormats:      cfg.KeyFormats,
+		RoleNameFormat:  cfg.RoleNameFormat,
+		MissingKeyError: cfg.MissingKeyError,
+		SandboxFuncs:    cfg.SandboxFuncs,
+		Guardrails:      cfg.Guardrails,
+	}
+
+	if cfg.TemplateSource != nil {
+		ac.TemplateSource = cfg.TemplateSource
+	} else if len(cfg.Templates) > 0 {
+		ac.TemplateSource = NewMemTemplateSource(cfg.Templates)
+	}
+
+	k, err := NewKernel(ac)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = cfg.Load(k); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Load adds accounts, partials, policy templates and containers of
+// config to kernel. Created containers are returned in order of config.
+// Templates and settings of config, including guardrails, are not used.
+func (cfg *Config) Load(k *Kernel) ([]*Container, error) {
+	for _, account := range cfg.Accounts {
+		if err := k.AddAccount(account); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, g := range cfg.AccountGroups {
+		if err := k.AddAccountGroup(g); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range cfg.Partials {
+		if err := k.AddPartial(p); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ptc := range cfg.PolicyTemplates {
+		if err := k.AddPolicyTemplate("", cfg.policyTemplate(ptc)); err != nil {
+			return nil, err
+		}
+	}
+
+	containers := make([]*Container, 0, len(cfg.Containers))
+
+	for _, cc := range cfg.Containers {
+		c, err := k.NewContainer(cc.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.DenyOtherRegions = cc.DenyOtherRegions
+		c.Conditions = cc.Conditions
+		c.ABAC = cc.ABAC
+		c.DisableDenyUnknown = cc.DisableDenyUnknown
+		c.AllowListOnly = cc.AllowListOnly
+		c.ExcludeGuardrails = cc.ExcludeGuardrails
+
+		for _, ptc := range cc.PolicyTemplates {
+			if err = c.AddPolicyTemplate(cfg.policyTemplate(ptc)); err != nil {
+				return nil, err
+			}
+		}
+
+		containers = append(containers, c)
+	}
+
+	// Attachments are added after all policy templates,
+	// since they can refer to templates of other containers.
+	for i, cc := range cfg.Containers {
+		for _, ac := range cc.Attachments {
+			attachments, err := containers[i].AddAttachments(ac.PolicyTemplate, ac.Account, ac.AccountGroup, ac.Vars)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, a := range attachments {
+				a.VersionID = ac.VersionID
+			}
+		}
+	}
+
+	return containers, nil
+}
+
+// normalize converts values decoded by YAML parser.
+func (ptc *PolicyTemplateConfig) normalize() {
+	for k, v := range ptc.Consts {
+		ptc.Consts[k] = normalizeYAML(v)
+	}
+
+	for k, v := range ptc.Variables {
+		if v == nil {
+			v = &Variable{}
+			ptc.Variables[k] = v
+		}
+
+		v.Name = k
+		v.Default = normalizeYAML(v.Default)
+	}
+}
+
+// policyTemplate creates policy template from its config,
+// consts of config are merged into consts of template.
+func (cfg *Config) policyTemplate(ptc *PolicyTemplateConfig) *PolicyTemplate {
+	pt := &PolicyTemplate{
+		Key:       ptc.Key,
+		Template:  ptc.Template,
+		Format:    ptc.Format,
+		VersionID: ptc.VersionID,
+		SHA256:    ptc.SHA256,
+		Vars:      ptc.Vars,
+		Defaults:  ptc.Defaults,
+		InferVars: ptc.InferVars,
+		Partials:  ptc.Partials,
+		Consts:    ptc.Consts,
+		Scope:     ptc.Scope,
+	}
+
+	if len(cfg.Consts) > 0 {
+		pt.Consts = make(map[string]interface{}, len(cfg.Consts)+len(ptc.Consts))
+
+		for k, v := range cfg.Consts {
+			pt.Consts[k] = v
+		}
+
+		for k, v := range ptc.Consts {
+			pt.Consts[k] = v
+		}
+	}
+
+	names := make([]string, 0, len(ptc.Variables))
+
+	for name := range ptc.Variables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		pt.Variables = append(pt.Variables, ptc.Variables[name])
+	}
+
+	if sr := ptc.ServiceRole; sr != nil {
+		pt.ServiceRole = &ServiceRoleTemplate{
+			Name:               sr.Name,
+			Template:           &sr.Template,
+			AssumeRoleTemplate: &sr.AssumeRoleTemplate,
+		}
+	}
+
+	return pt
+}
+
+// ContainerPolicies are rendered policies of container in account.
+type ContainerPolicies struct {
+	Policies     []*IAMPolicyDoc               `json:"policies"`
+	RolePolicies []*IAMPolicyDoc               `json:"role_policies"`
+	ServiceRoles map[string]*ServiceRolePolicy `json:"service_roles,omitempty"`
+	Guardrails   []string                      `json:"guardrails"`
+}
+
+// RenderAccounts renders policies of all containers, indexed by
+// account name and container ID. Missing templates are reported
+// as errors, warnings of containers are returned.
+func (a *Kernel) RenderAccounts() (map[string]map[string]*ContainerPolicies, []string, error) {
+	a.RLock()
+
+	ids := make([]string, 0, len(a.containers))
+
+	for id := range a.containers {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	a.RUnlock()
+
+	sort.Strings(ids)
+
+	var warnings []string
+
+	res := make(map[string]map[string]*ContainerPolicies)
+
+	for _, id := range ids {
+		a.RLock()
+		c := a.containers[id]
+		a.RUnlock()
+
+		p, err, missing := c.Policy()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("container '%s': %s", id, err)
+		}
+
+		if len(missing) > 0 {
+			return nil, nil, fmt.Errorf("container '%s': policy template '%s' not found for account '%s'", id, missing[0].pt.Key, missing[0].account.Name)
+		}
+
+		for _, w := range p.Warnings {
+			warnings = append(warnings, fmt.Sprintf("container '%s': %s", id, w))
+		}
+
+		for account, policies := range p.AccountPolicies {
+			if res[account] == nil {
+				res[account] = make(map[string]*ContainerPolicies)
+			}
+
+			cp := &ContainerPolicies{
+				Policies:     policies,
+				RolePolicies: p.AccountRolePolicies[account],
+				Guardrails:   p.Guardrails[account],
+			}
+
+			if len(p.ServiceRolePolicies[account]) > 0 {
+				cp.ServiceRoles = p.ServiceRolePolicies[account]
+			}
+
+			res[account][id] = cp
+		}
+	}
+
+	return res, warnings, nil
+}
@@ -0,0 +1,131 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+consts:
+  org: example
+  env: shared
+
+policy_templates:
+  - key: base
+    scope: ["s3:*"]
+    consts:
+      env: base
+    template: |
+      {"Statement": [{"Sid": "{{ .org }}{{ .env }}", "Effect": "Allow", "Action": "s3:ListAllMyBuckets", "Resource": "*"}]}
+
+accounts:
+  - {id: "111111111111", name: prod, short_name: p}
+
+containers:
+  - id: app
+    policy_templates:
+      - key: app
+        scope: ["sqs:*"]
+        variables:
+          queues: {type: list}
+        template: |
+          {"Statement": [{"Sid": "{{ .org }}{{ .env }}", "Effect": "Allow", "Action": "sqs:*", "Resource": {{ jsonList .vars.queues }}}]}
+    attachments:
+      - {policy_template: base, account: prod}
+      - {policy_template: app, account: prod, vars: {queues: [q1, q2]}}
+`
+
+func TestConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testConfig))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := cfg.Load(k)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 1 || containers[0].ID != "app" {
+		t.Fatalf("unexpected containers %v", containers)
+	}
+
+	policy, err, _ := containers[0].Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := policy.AccountPolicies["prod"][0].Statements
+
+	if statements[0].Sid != "examplebase" || statements[1].Sid != "exampleshared" || len(statements[1].Resources) != 2 {
+		t.Fatalf("unexpected statements %+v %+v", statements[0], statements[1])
+	}
+
+	if _, err = ParseConfig([]byte("account: []")); err == nil || !strings.Contains(err.Error(), "field account not found") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+
+	if _, err = cfg.Load(k); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+}
+
+func TestRenderAccounts(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+guardrails:
+  - {name: DenyLeaveOrganization, actions: ["organizations:LeaveOrganization"]}
+` + testConfig + `
+  - id: other
+    exclude_guardrails: [DenyLeaveOrganization]
+    policy_templates:
+      - key: other
+        scope: ["sns:*"]
+        variables:
+          unused: {type: string}
+        template: |
+          {"Statement": [{"Effect": "Allow", "Action": "sns:Publish", "Resource": "*"}]}
+    attachments:
+      - {policy_template: other, account: prod, vars: {unused: x}}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := cfg.NewKernel()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, warnings, err := k.RenderAccounts()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 1 || accounts["prod"]["app"] == nil || accounts["prod"]["other"] == nil {
+		t.Fatalf("unexpected accounts %v", accounts)
+	}
+
+	if strings.Join(accounts["prod"]["app"].Guardrails, ",") != "DenyUnknownServices,DenyLeaveOrganization,AllowAll" {
+		t.Fatalf("unexpected guardrails %v", accounts["prod"]["app"].Guardrails)
+	}
+
+	if strings.Join(accounts["prod"]["other"].Guardrails, ",") != "DenyUnknownServices,AllowAll" {
+		t.Fatalf("unexpected guardrails %v", accounts["prod"]["other"].Guardrails)
+	}
+
+	if len(warnings) != 1 || warnings[0] != "container 'other': variable 'unused' is declared, but not used in policy template 'other'" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
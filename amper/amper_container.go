@@ -2,6 +2,7 @@ package amper
 
 import (
 	"fmt"
+	"log"
 	"sort"
 	"sync"
 )
@@ -9,7 +10,11 @@ import (
 type Attachment struct {
 	pt      *PolicyTemplate
 	account *Account
-	vars    map[string]string
+	vars    map[string]interface{}
+
+	// VersionID pins version of fetched template for this attachment,
+	// overrides PolicyTemplate.VersionID.
+	VersionID string
 }
 
 func (a Attachment) String() string {
@@ -23,9 +28,83 @@ type Container struct {
 
 	ID string
 
+	// Conditions are injected into Allow statements of container's
+	// policies and service role policies, see InjectedCondition.
+	Conditions []*InjectedCondition
+
+	// DenyOtherRegions adds statement, which denies requests to regions,
+	// which are not allowed in account, see Account.Regions.
+	DenyOtherRegions bool
+
+	// ABAC scopes Allow statements on taggable resources to resources
+	// tagged with container's tag, see ABAC.
+	ABAC *ABAC
+
+	// DisableDenyUnknown disables DenyUnknownServices and DenyAll
+	// statements, which deny services out of scope of templates.
+	DisableDenyUnknown bool
+
+	// AllowListOnly disables AllowAll statement, so only actions
+	// allowed by templates are allowed.
+	AllowListOnly bool
+
+	// ExcludeGuardrails are names of kernel guardrails, which are not
+	// added to policies of container, see Kernel.AddGuardrail.
+	ExcludeGuardrails []string
+
 	attachments []*Attachment
 }
 
+// RegionDenyExemptActions are actions of global services, which are not
+// denied by DenyOtherRegions, since their requests go to single region.
+var RegionDenyExemptActions = []string{
+	"account:*",
+	"aws-portal:*",
+	"budgets:*",
+	"ce:*",
+	"cloudfront:*",
+	"globalaccelerator:*",
+	"health:*",
+	"iam:*",
+	"organizations:*",
+	"route53:*",
+	"route53domains:*",
+	"shield:*",
+	"sts:*",
+	"support:*",
+	"trustedadvisor:*",
+	"waf:*",
+}
+
+// denyOtherRegions returns statement, which denies requests to regions
+// not allowed in account, or nil, if account has no allowed regions.
+func denyOtherRegions(account *Account) *IAMPolicyStatement {
+	if len(account.Regions) == 0 {
+		return nil
+	}
+
+	regions := append(StringList{}, account.Regions...)
+	sort.Strings(regions)
+
+	return &IAMPolicyStatement{
+		Sid:        GuardrailDenyOtherRegions,
+		Effect:     "Deny",
+		NotActions: RegionDenyExemptActions,
+		Resources:  []string{"*"},
+		Conditions: map[string]map[string]StringList{
+			"StringNotEquals": {
+				"aws:RequestedRegion": regions,
+			},
+		},
+	}
+}
+
+// PolicyTemplateID returns qualified ID of policy template of container.
+// Attachments can refer to policy template by its key or qualified ID.
+func PolicyTemplateID(containerID, key string) string {
+	return containerID + "/" + key
+}
+
 func (c *Container) AddPolicyTemplate(pt *PolicyTemplate) error {
 	c.amper.Lock()
 	defer c.amper.Unlock()
@@ -34,19 +113,44 @@ func (c *Container) AddPolicyTemplate(pt *PolicyTemplate) error {
 		return fmt.Errorf("policy template '%s' already exists", pt.Key)
 	}
 
+	return c.addPolicyTemplate(pt)
+}
+
+// addPolicyTemplate registers policy template by its qualified ID and
+// by its key, if key is not taken by template of other container.
+// Kernel must be locked.
+func (c *Container) addPolicyTemplate(pt *PolicyTemplate) error {
+	id := PolicyTemplateID(c.ID, pt.Key)
+
+	if _, ok := c.amper.policyTemplates[id]; ok {
+		return fmt.Errorf("policy template '%s' already exists in container '%s'", pt.Key, c.ID)
+	}
+
 	if pt.container != nil || pt.amper != nil {
 		return fmt.Errorf("policy '%s' is in unknown state", pt.Key)
 	}
 
+	if _, err := pt.variables(); err != nil {
+		return err
+	}
+
+	if err := ValidateTemplateFormat(pt.Format); err != nil {
+		return fmt.Errorf("invalid policy template '%s': %s", pt.Key, err)
+	}
+
 	pt.amper = c.amper
 	pt.container = c
 
-	c.amper.policyTemplates[pt.Key] = pt
+	c.amper.policyTemplates[id] = pt
+
+	if _, ok := c.amper.policyTemplates[pt.Key]; !ok {
+		c.amper.policyTemplates[pt.Key] = pt
+	}
 
 	return nil
 }
 
-func (c *Container) AddAttachment(policyTemplateID string, accountName string, vars map[string]string) (*Attachment, error) {
+func (c *Container) AddAttachment(policyTemplateID string, accountName string, vars map[string]interface{}) (*Attachment, error) {
 	c.amper.RLock()
 	defer c.amper.RUnlock()
 
@@ -59,16 +163,20 @@ func (c *Container) AddAttachment(policyTemplateID string, accountName string, v
 		return nil, fmt.Errorf("cannot add attachment, unknown policy template '%s' in container '%s'", policyTemplateID, c.ID)
 	}
 
-	account, ok := c.amper.accounts[accountName]
+	account, ok := c.amper.findAccount(accountName)
 
 	if !ok {
 		return nil, fmt.Errorf("cannot add attachment, unknown account '%s' in container '%s'", accountName, c.ID)
 	}
 
-	for _, varName := range pt.Vars {
-		if _, ok := vars[varName]; !ok {
-			return nil, fmt.Errorf("cannot add attachment, variable '%s' is not set in container '%s'", varName, c.ID)
-		}
+	variables, err := pt.variables()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = templateVarValues(variables, vars); err != nil {
+		return nil, fmt.Errorf("cannot add attachment of '%s' in container '%s': %s", policyTemplateID, c.ID, err)
 	}
 
 	attachment := &Attachment{
@@ -97,13 +205,23 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 	accountRolePolicies := make(map[string][]*IAMPolicyDoc)
 	serviceRolePolicies := make(map[string]map[string]*ServiceRolePolicy)
 	scopeMap := make(map[string]map[string]bool)
+	warnings := make(map[string]bool)
+
+	addWarnings := func(ws []string) {
+		for _, w := range ws {
+			if !warnings[w] {
+				warnings[w] = true
+				p.Warnings = append(p.Warnings, w)
+			}
+		}
+	}
 
 	for _, a := range c.attachments {
 		if serviceRolePolicies[a.account.Name] == nil {
 			serviceRolePolicies[a.account.Name] = make(map[string]*ServiceRolePolicy)
 		}
 
-		pd, err := a.pt.renderTemplate(c, a.account, a.vars)
+		spec, err := a.pt.resolve(a.account, a.VersionID)
 
 		if err != nil {
 			return nil, err, nil
@@ -113,62 +231,110 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 			scopeMap[a.account.Name] = make(map[string]bool)
 		}
 
-		if pd == nil {
+		if spec == nil {
 			// Policy not found
-			fmt.Printf("[WARN] Policy template '%s' not found\n", a.pt.Key)
+			log.Printf("[WARN] Policy template '%s' not found", a.pt.Key)
 			accountPolicies[a.account.Name] = append(accountPolicies[a.account.Name], &IAMPolicyDoc{})
 			missing = append(missing, a)
 			continue
 		}
 
+		addWarnings(spec.warnings)
+
+		if spec.fetched != nil {
+			p.Provenance = append(p.Provenance, &TemplateProvenance{
+				Account:         a.account.Name,
+				TemplateKey:     a.pt.Key,
+				FetchedTemplate: spec.fetched,
+			})
+		}
+
+		pd, err := spec.renderTemplate(c, a.account, a.vars)
+
+		if err != nil {
+			return nil, err, nil
+		}
+
+		if err = c.applyABAC(pd); err != nil {
+			return nil, err, nil
+		}
+
 		if pd.Version != "" && pd.Version != IAMPolicyVersion {
 			return nil, fmt.Errorf("Unsupported policy version '%s'", pd.Version), nil
 		}
 
 		accountPolicies[a.account.Name] = append(accountPolicies[a.account.Name], pd)
 
-		for _, s := range a.pt.Scope {
+		for _, s := range spec.scope {
 			scopeMap[a.account.Name][s] = true
 		}
 
-		if a.pt.ServiceRole != nil {
+		if spec.serviceRole != nil {
 			srp := &ServiceRolePolicy{}
 
-			srp.Policy, err = a.pt.renderServiceRole(c, a.account, a.vars)
+			srp.Policy, err = spec.renderServiceRole(c, a.account, a.vars)
 
 			if err != nil {
 				return nil, err, nil
 			}
 
-			srp.AssumeRolePolicy, err = a.pt.renderServiceAssumeRole(c, a.account, a.vars)
+			if err = c.applyABAC(srp.Policy); err != nil {
+				return nil, err, nil
+			}
+
+			if err = c.injectConditions([]*IAMPolicyDoc{srp.Policy}); err != nil {
+				return nil, err, nil
+			}
+
+			srp.AssumeRolePolicy, err = spec.renderServiceAssumeRole(c, a.account, a.vars)
 
 			if err != nil {
 				return nil, err, nil
 			}
 
-			serviceRolePolicies[a.account.Name][a.pt.ServiceRole.Name] = srp
+			serviceRolePolicies[a.account.Name][spec.serviceRole.Name] = srp
 		}
 	}
 
-	allowAll := &IAMPolicyStatement{
-		Sid:       "AllowAll",
-		Effect:    "Allow",
-		Actions:   []string{"*"},
-		Resources: []string{"*"},
+	excluded := make(map[string]bool, len(c.ExcludeGuardrails))
+
+	for _, name := range c.ExcludeGuardrails {
+		excluded[name] = true
+	}
+
+	named := make([]*Guardrail, 0, len(c.amper.guardrails))
+
+	for _, g := range c.amper.guardrails {
+		if excluded[g.Name] {
+			delete(excluded, g.Name)
+			continue
+		}
+
+		named = append(named, g)
+	}
+
+	for _, name := range c.ExcludeGuardrails {
+		if excluded[name] {
+			return nil, fmt.Errorf("unknown guardrail '%s' excluded in container '%s'", name, c.ID), nil
+		}
 	}
 
+	guardrailNames := make(map[string][]string)
+
 	for account, po := range scopeMap {
-		var denyUnknown *IAMPolicyStatement
+		var guardrails []*IAMPolicyStatement
 
-		if len(po) == 0 {
+		switch {
+		case c.DisableDenyUnknown:
+		case len(po) == 0:
 			// Nothing will be allowed!
-			denyUnknown = &IAMPolicyStatement{
-				Sid:       "DenyAll",
+			guardrails = append(guardrails, &IAMPolicyStatement{
+				Sid:       GuardrailDenyAll,
 				Effect:    "Deny",
 				Actions:   []string{"*"},
 				Resources: []string{"*"},
-			}
-		} else {
+			})
+		default:
 			scopes := make([]string, 0, len(po))
 
 			for k := range po {
@@ -177,30 +343,62 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 
 			sort.Sort(sort.StringSlice(scopes))
 
-			denyUnknown = &IAMPolicyStatement{
-				Sid:        "DenyUnknownServices",
+			guardrails = append(guardrails, &IAMPolicyStatement{
+				Sid:        GuardrailDenyUnknownServices,
 				Effect:     "Deny",
 				NotActions: scopes,
 				Resources:  []string{"*"},
+			})
+		}
+
+		if c.DenyOtherRegions {
+			if s := denyOtherRegions(c.amper.accounts[account]); s != nil {
+				guardrails = append(guardrails, s)
 			}
 		}
 
-		accountPolicies[account] = append(accountPolicies[account], &IAMPolicyDoc{
-			Statements: []*IAMPolicyStatement{denyUnknown},
-		})
+		for _, g := range named {
+			guardrails = append(guardrails, g.statement())
+		}
+
+		for _, s := range guardrails {
+			guardrailNames[account] = append(guardrailNames[account], s.Sid)
+		}
+
+		if len(guardrails) > 0 {
+			accountPolicies[account] = append(accountPolicies[account], &IAMPolicyDoc{
+				Statements: guardrails,
+			})
+		}
 
 		accountRolePolicies[account] = accountPolicies[account]
 
-		if len(po) > 0 {
+		if len(po) > 0 && !c.AllowListOnly {
+			allowAll := &IAMPolicyStatement{
+				Sid:       GuardrailAllowAll,
+				Effect:    "Allow",
+				Actions:   []string{"*"},
+				Resources: []string{"*"},
+			}
+
 			accountPolicies[account] = append(accountPolicies[account], &IAMPolicyDoc{
 				Statements: []*IAMPolicyStatement{allowAll},
 			})
+
+			guardrailNames[account] = append(guardrailNames[account], allowAll.Sid)
+		}
+
+		// Role policies are prefix of account policies,
+		// so conditions are injected into them too.
+		if err = c.injectConditions(accountPolicies[account]); err != nil {
+			return nil, err, nil
 		}
 	}
 
 	p.AccountPolicies = accountPolicies
 	p.AccountRolePolicies = accountRolePolicies
 	p.ServiceRolePolicies = serviceRolePolicies
+	p.Guardrails = guardrailNames
 
 	if err = p.compress(); err != nil {
 		return
@@ -0,0 +1,89 @@
+package amper
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Names of guardrail statements generated by container. Names are used
+// as Sid of statements and listed in Policy.Guardrails.
+const (
+	GuardrailDenyAll             = "DenyAll"
+	GuardrailDenyUnknownServices = "DenyUnknownServices"
+	GuardrailDenyOtherRegions    = "DenyOtherRegions"
+	GuardrailAllowAll            = "AllowAll"
+)
+
+var builtinGuardrails = map[string]bool{
+	GuardrailDenyAll:             true,
+	GuardrailDenyUnknownServices: true,
+	GuardrailDenyOtherRegions:    true,
+	GuardrailAllowAll:            true,
+}
+
+var guardrailNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// Guardrail is named Deny statement, which is added to policies of all
+// containers, like denying organizations:LeaveOrganization. Containers
+// can opt out of it, see Container.ExcludeGuardrails.
+type Guardrail struct {
+	// Name is used as Sid of statement.
+	Name string `yaml:"name"`
+
+	Actions    StringList `yaml:"actions"`
+	NotActions StringList `yaml:"not_actions"`
+
+	// Resources defaults to "*".
+	Resources StringList `yaml:"resources"`
+
+	Conditions map[string]map[string]StringList `yaml:"conditions"`
+}
+
+// statement returns new Deny statement of guardrail.
+func (g *Guardrail) statement() *IAMPolicyStatement {
+	s := &IAMPolicyStatement{
+		Sid:        g.Name,
+		Effect:     "Deny",
+		Actions:    g.Actions,
+		NotActions: g.NotActions,
+		Resources:  g.Resources,
+		Conditions: g.Conditions,
+	}
+
+	if len(s.Resources) == 0 {
+		s.Resources = StringList{"*"}
+	}
+
+	return s
+}
+
+// AddGuardrail registers guardrail, which is applied to every container.
+// Guardrails are added to policies in order of registration, so they
+// should be registered before policies are rendered, see
+// AmperConfig.Guardrails.
+func (a *Kernel) AddGuardrail(g *Guardrail) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if !guardrailNameRegexp.MatchString(g.Name) {
+		return fmt.Errorf("invalid guardrail name '%s', must be alphanumeric", g.Name)
+	}
+
+	if builtinGuardrails[g.Name] {
+		return fmt.Errorf("guardrail name '%s' is reserved", g.Name)
+	}
+
+	for _, e := range a.guardrails {
+		if e.Name == g.Name {
+			return fmt.Errorf("guardrail '%s' already exists", g.Name)
+		}
+	}
+
+	if (len(g.Actions) == 0) == (len(g.NotActions) == 0) {
+		return fmt.Errorf("invalid guardrail '%s', either actions or not_actions must be set", g.Name)
+	}
+
+	a.guardrails = append(a.guardrails, g)
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestGuardrails(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{
+		Guardrails: []*Guardrail{
+			{Name: "DenyLeaveOrganization", Actions: StringList{"organizations:LeaveOrganization"}},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "111111111111", Name: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddGuardrail(&Guardrail{Name: "ProtectCloudTrail", Actions: StringList{"cloudtrail:StopLogging", "cloudtrail:DeleteTrail"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		g   *Guardrail
+		err string
+	}{
+		{&Guardrail{Name: "ProtectCloudTrail", Actions: StringList{"*"}}, "already exists"},
+		{&Guardrail{Name: GuardrailAllowAll, Actions: StringList{"*"}}, "is reserved"},
+		{&Guardrail{Name: "Deny-All", Actions: StringList{"*"}}, "must be alphanumeric"},
+		{&Guardrail{Name: "Empty"}, "either actions or not_actions"},
+	} {
+		if err := amper.AddGuardrail(test.g); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error '%s', got %v", test.err, err)
+		}
+	}
+
+	for i, test := range []struct {
+		disableDenyUnknown bool
+		allowListOnly      bool
+		exclude            []string
+		expected           string
+		err                string
+	}{
+		{false, false, nil, "DenyUnknownServices,DenyLeaveOrganization,ProtectCloudTrail,AllowAll", ""},
+		{true, false, nil, "DenyLeaveOrganization,ProtectCloudTrail,AllowAll", ""},
+		{false, true, nil, "DenyUnknownServices,DenyLeaveOrganization,ProtectCloudTrail", ""},
+		{false, false, []string{"DenyLeaveOrganization"}, "DenyUnknownServices,ProtectCloudTrail,AllowAll", ""},
+		{false, false, []string{"ProtectCloudTrail", "DenyLeaveOrganization"}, "DenyUnknownServices,AllowAll", ""},
+		{false, false, []string{"Unknown"}, "", "unknown guardrail 'Unknown'"},
+	} {
+		c, err := amper.NewContainer(string('a' + rune(i)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.DisableDenyUnknown = test.disableDenyUnknown
+		c.AllowListOnly = test.allowListOnly
+		c.ExcludeGuardrails = test.exclude
+
+		err = c.AddPolicyTemplate(&PolicyTemplate{
+			Key:      "t" + c.ID,
+			Scope:    []string{"s3:*"},
+			Template: aws.String(`{"Statement": [{"Sid": "Get", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = c.AddAttachment("t"+c.ID, "prod", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		policy, err, _ := c.Policy()
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error '%s', got %v", test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res := strings.Join(policy.Guardrails["prod"], ","); res != test.expected {
+			t.Fatalf("unexpected guardrails of container '%s', expected '%s', got '%s'", c.ID, test.expected, res)
+		}
+
+		var sids []string
+
+		for _, s := range policy.AccountPolicies["prod"][0].Statements {
+			if s.Sid != "Get" {
+				sids = append(sids, s.Sid)
+			}
+		}
+
+		if res := strings.Join(sids, ","); res != test.expected {
+			t.Fatalf("unexpected statements of container '%s', expected '%s', got '%s'", c.ID, test.expected, res)
+		}
+	}
+}
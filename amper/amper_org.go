@@ -0,0 +1,174 @@
+package amper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+)
+
+// DefaultOrgNameFormat is the default format of names of imported
+// organization accounts. Short names are not set by default.
+const DefaultOrgNameFormat = "{{ slug .Name }}"
+
+// OrgExport is the output of `aws organizations list-accounts`.
+type OrgExport struct {
+	Accounts []*OrgAccount
+}
+
+// OrgAccount is account of organization. OU and Tags are not part of
+// list-accounts output, they can be added to export separately.
+type OrgAccount struct {
+	Id     string
+	Arn    string
+	Email  string
+	Name   string
+	Status string
+
+	// OU is the name or path of organizational unit of account.
+	OU   string
+	Tags []*OrgTag
+}
+
+type OrgTag struct {
+	Key   string
+	Value string
+}
+
+// OrgImport derives accounts from organization export. Names are
+// rendered from templates with Id, Arn, Email, Name, Status, OU and
+// Tags (as map) of organization account.
+type OrgImport struct {
+	NameFormat string
+
+	// ShortNameFormat is optional, accounts have no short names,
+	// if it's not set.
+	ShortNameFormat string
+
+	// IncludeInactive imports accounts, which status is not ACTIVE.
+	IncludeInactive bool
+}
+
+var slugRegexp = regexp.MustCompile(`[^0-9a-z]+`)
+
+// slug converts s into lower-case alphanumeric string with hyphens.
+func slug(s string) string {
+	return strings.Trim(slugRegexp.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// ReadOrgExport decodes organization export.
+func ReadOrgExport(data []byte) (*OrgExport, error) {
+	export := &OrgExport{}
+
+	if err := json.Unmarshal(data, export); err != nil {
+		return nil, fmt.Errorf("invalid organization export: %s", err)
+	}
+
+	return export, nil
+}
+
+// Accounts derives accounts from organization export. Accounts are
+// joined to group of their OU, named as slug of OU.
+func (imp *OrgImport) Accounts(export *OrgExport) ([]*Account, error) {
+	nameTpl, err := imp.parse("name", imp.NameFormat, DefaultOrgNameFormat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var shortNameTpl *template.Template
+
+	if imp.ShortNameFormat != "" {
+		if shortNameTpl, err = imp.parse("short name", imp.ShortNameFormat, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var res []*Account
+
+	for _, oa := range export.Accounts {
+		if oa.Status != "" && oa.Status != "ACTIVE" && !imp.IncludeInactive {
+			continue
+		}
+
+		tags := make(map[string]string, len(oa.Tags))
+
+		for _, t := range oa.Tags {
+			tags[t.Key] = t.Value
+		}
+
+		data := map[string]interface{}{
+			"Id":     oa.Id,
+			"Arn":    oa.Arn,
+			"Email":  oa.Email,
+			"Name":   oa.Name,
+			"Status": oa.Status,
+			"OU":     oa.OU,
+			"Tags":   tags,
+		}
+
+		account := &Account{
+			ID:    oa.Id,
+			Email: oa.Email,
+		}
+
+		if account.Name, err = execOrgFormat(nameTpl, data); err != nil {
+			return nil, fmt.Errorf("cannot derive name of account '%s': %s", oa.Id, err)
+		}
+
+		if shortNameTpl != nil {
+			if account.ShortName, err = execOrgFormat(shortNameTpl, data); err != nil {
+				return nil, fmt.Errorf("cannot derive short name of account '%s': %s", oa.Id, err)
+			}
+		}
+
+		if len(tags) > 0 {
+			account.Tags = tags
+		}
+
+		if oa.OU != "" {
+			account.Groups = []string{slug(oa.OU)}
+		}
+
+		res = append(res, account)
+	}
+
+	return res, nil
+}
+
+func (imp *OrgImport) parse(name, format, def string) (*template.Template, error) {
+	if format == "" {
+		format = def
+	}
+
+	funcs := sprig.HermeticTxtFuncMap()
+	funcs["slug"] = slug
+
+	tpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(format)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s format: %s", name, err)
+	}
+
+	return tpl, nil
+}
+
+func execOrgFormat(tpl *template.Template, data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	res := strings.TrimSpace(buf.String())
+
+	if res == "" {
+		return "", fmt.Errorf("%s is empty", tpl.Name())
+	}
+
+	return res, nil
+}
@@ -0,0 +1,69 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOrgExport = `{
+  "Accounts": [
+    {"Id": "111111111111", "Arn": "arn:aws:organizations::000000000000:account/o-1/111111111111", "Email": "prod@example.com", "Name": "Prod EU", "Status": "ACTIVE", "JoinedMethod": "CREATED", "JoinedTimestamp": 1546300800.0,
+     "OU": "Workloads/Prod", "Tags": [{"Key": "short", "Value": "pe"}]},
+    {"Id": "222222222222", "Email": "dev@example.com", "Name": "Dev", "Status": "ACTIVE"},
+    {"Id": "333333333333", "Email": "old@example.com", "Name": "Old", "Status": "SUSPENDED"}
+  ]
+}`
+
+func TestOrgImport(t *testing.T) {
+	export, err := ReadOrgExport([]byte(testOrgExport))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imp := &OrgImport{
+		ShortNameFormat: `{{ .Tags.short | default (slug .Name) }}`,
+	}
+
+	accounts, err := imp.Accounts(export)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(accounts))
+	}
+
+	a := accounts[0]
+
+	if a.ID != "111111111111" || a.Name != "prod-eu" || a.ShortName != "pe" || a.Email != "prod@example.com" || a.Tags["short"] != "pe" || a.Groups[0] != "workloads-prod" {
+		t.Fatalf("unexpected account %+v", a)
+	}
+
+	if a = accounts[1]; a.Name != "dev" || a.ShortName != "dev" {
+		t.Fatalf("unexpected account %+v", a)
+	}
+
+	imp.IncludeInactive = true
+
+	if accounts, err = imp.Accounts(export); err != nil || len(accounts) != 3 {
+		t.Fatalf("expected 3 accounts, got %d, %v", len(accounts), err)
+	}
+
+	imp.NameFormat = "{{ .Tags.missing }}"
+
+	if _, err = imp.Accounts(export); err == nil || !strings.Contains(err.Error(), "name is empty") {
+		t.Fatalf("expected empty name error, got %v", err)
+	}
+
+	imp = &OrgImport{}
+
+	if accounts, err = imp.Accounts(export); err != nil {
+		t.Fatal(err)
+	}
+
+	if a = accounts[0]; a.Name != "prod-eu" || a.ShortName != "" {
+		t.Fatalf("unexpected account %+v", a)
+	}
+}
@@ -10,6 +10,15 @@ type ServiceRolePolicy struct {
 	AssumeRolePolicy *IAMPolicyDoc
 }
 
+// TemplateProvenance records, which fetched template was used
+// for rendering attachment in account.
+type TemplateProvenance struct {
+	Account     string
+	TemplateKey string
+
+	*FetchedTemplate
+}
+
 type Policy struct {
 	amper *Kernel
 
@@ -17,6 +26,16 @@ type Policy struct {
 	AccountRolePolicies map[string][]*IAMPolicyDoc
 
 	ServiceRolePolicies map[string]map[string]*ServiceRolePolicy
+
+	// Provenance contains fetched templates in order of attachments.
+	Provenance []*TemplateProvenance
+
+	// Warnings contains non-fatal problems found in templates.
+	Warnings []string
+
+	// Guardrails contains names of guardrail statements, indexed
+	// by account name, in order of policies.
+	Guardrails map[string][]string
 }
 
 const DefaultManagedPoliciesPerRole = 10
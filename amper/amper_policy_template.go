@@ -2,16 +2,9 @@ package amper
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"text/template"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/s3"
-
-	"github.com/Masterminds/sprig"
 )
 
 type ServiceRoleTemplate struct {
@@ -25,18 +18,51 @@ type PolicyTemplate struct {
 
 	amper     *Kernel
 	container *Container
-	notFound  bool
+
+	// fetched contains templates fetched from TemplateSource,
+	// indexed by resolved key and version. Missing templates are stored as nil.
+	fetched map[string]*FetchedTemplate
 
 	// Key is the uniqie identifier of policy template
 	Key string
 
 	// Template is pointer to template's content.
-	// If it's nil, template will be fetched from StateBucket
+	// If it's nil, template will be fetched from TemplateSource
 	Template *string
 
+	// Format is the format of rendered template, one of
+	// TemplateFormatJSON (default), TemplateFormatYAML or TemplateFormatHCL.
+	Format string
+
+	// VersionID pins version of template fetched from TemplateSource.
+	// Can be overridden by attachment.
+	VersionID string
+
+	// SHA256 is expected hex encoded checksum of fetched template.
+	SHA256 string
+
+	// RequireSignature requires fetched template to have valid
+	// detached signature, see TemplateSignatureSuffix.
+	RequireSignature bool
+
 	// Vars contains list of required variables for rendering this template
 	Vars []string
 
+	// Defaults contains default values of variables.
+	Defaults map[string]string
+
+	// Variables contains typed variables of template.
+	// Vars and Defaults are shorthands for string variables.
+	Variables []*Variable
+
+	// InferVars makes all variables referenced in template required,
+	// without declaring them.
+	InferVars bool
+
+	// Partials contains names of partials, which statements are
+	// merged into rendered policy.
+	Partials []string
+
 	// Consts contains list of constants.
 	Consts map[string]interface{}
 
@@ -47,143 +73,314 @@ type PolicyTemplate struct {
 	ServiceRole *ServiceRoleTemplate
 }
 
-func (pt *PolicyTemplate) render(name string, txt *string, vars map[string]interface{}) (*IAMPolicyDoc, error) {
+// parseTemplate parses template text with all available functions and
+// partials. Functions are bound to given context, see funcMap.
+func parseTemplate(name, txt string, ctx *renderContext) (*template.Template, error) {
 	tpl, err := template.
 		New(name).
-		Funcs(sprig.TxtFuncMap()).
-		Parse(*txt)
+		Funcs(ctx.funcMap()).
+		Parse(txt)
 
 	if err != nil {
 		return nil, err
 	}
 
-	var policyBuf bytes.Buffer
+	if err = ctx.addPartials(tpl); err != nil {
+		return nil, err
+	}
+
+	return tpl, nil
+}
+
+// execute renders template text with given data.
+func (pt *PolicyTemplate) execute(name, txt string, data interface{}, ctx *renderContext) ([]byte, error) {
+	tpl, err := parseTemplate(name, txt, ctx)
 
-	if err = tpl.Execute(&policyBuf, vars); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
-	a := &IAMPolicyDoc{}
+	if pt.amper.MissingKeyError {
+		tpl.Option("missingkey=error")
+	}
+
+	var buf bytes.Buffer
 
-	if err := json.Unmarshal(policyBuf.Bytes(), a); err != nil {
+	if err = tpl.Execute(&buf, data); err != nil {
 		return nil, err
 	}
 
-	return a, nil
+	return buf.Bytes(), nil
+}
+
+func (pt *PolicyTemplate) render(name, format string, txt *string, vars map[string]interface{}, ctx *renderContext) (*IAMPolicyDoc, error) {
+	if format == TemplateFormatData {
+		return pt.renderData(name, *txt, vars, ctx)
+	}
+
+	data, err := pt.execute(name, *txt, vars, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePolicyDoc(name, format, data)
+}
+
+// templateSpec is effective definition of policy template for account.
+// For fetched templates, it includes metadata from front-matter.
+type templateSpec struct {
+	pt *PolicyTemplate
+
+	template    *string
+	format      string
+	variables   map[string]*Variable
+	consts      map[string]interface{}
+	scope       []string
+	partials    []string
+	serviceRole *ServiceRoleTemplate
+
+	// fetched is set, if template was fetched from TemplateSource.
+	fetched *FetchedTemplate
+
+	// warnings are produced by analysis of template.
+	warnings []string
+}
+
+// variables returns variable schema of policy template.
+func (pt *PolicyTemplate) variables() (map[string]*Variable, error) {
+	variables, err := templateVariables(pt.Vars, pt.Defaults, pt.Variables)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid variables of policy template '%s': %s", pt.Key, err)
+	}
+
+	return variables, nil
 }
 
-func (pt *PolicyTemplate) renderTemplate(c *Container, account *Account, vars map[string]string) (*IAMPolicyDoc, error) {
+// resolve returns effective template spec for given account.
+// If template is not found in TemplateSource, nil is returned.
+func (pt *PolicyTemplate) resolve(account *Account, versionID string) (*templateSpec, error) {
 	pt.Lock()
 	defer pt.Unlock()
 
-	if pt.notFound {
-		return nil, nil
+	variables, err := pt.variables()
+
+	if err != nil {
+		return nil, err
 	}
 
-	if pt.Template == nil {
-		tpl, err := pt.fetchTemplate()
+	spec := &templateSpec{
+		pt:          pt,
+		template:    pt.Template,
+		format:      pt.Format,
+		variables:   variables,
+		consts:      pt.Consts,
+		scope:       pt.Scope,
+		partials:    pt.Partials,
+		serviceRole: pt.ServiceRole,
+	}
 
-		if err != nil {
+	if spec.template != nil {
+		if spec.warnings, err = spec.analyzeVars(); err != nil {
 			return nil, err
 		}
 
-		if tpl == nil {
-			pt.notFound = true
-			return nil, nil
+		return spec, nil
+	}
+
+	if versionID == "" {
+		versionID = pt.VersionID
+	}
+
+	fetched, err := pt.fetchTemplate(account, versionID)
+
+	if err != nil || fetched == nil {
+		return nil, err
+	}
+
+	spec.fetched = fetched
+	spec.template = &fetched.Body
+
+	if fetched.Meta != nil {
+		if err = spec.merge(fetched.Meta); err != nil {
+			return nil, fmt.Errorf("conflicting front-matter in template '%s': %s", fetched.Key, err)
 		}
+	}
+
+	if spec.warnings, err = spec.analyzeVars(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+func (s *templateSpec) templateVars(c *Container, account *Account, vars map[string]interface{}) (map[string]interface{}, error) {
+	allVars, err := templateVarValues(s.variables, vars)
 
-		pt.Template = tpl
+	if err != nil {
+		return nil, fmt.Errorf("policy template '%s' in container '%s': %s", s.pt.Key, c.ID, err)
 	}
 
 	templateVars := map[string]interface{}{
 		"container": c,
 		"account":   account,
-		"vars":      vars,
+		"vars":      allVars,
 	}
 
-	for k, v := range pt.Consts {
+	for k, v := range s.consts {
 		templateVars[k] = v
 	}
 
-	return pt.render(fmt.Sprintf("container=%s,template=%s,account=%s", c.ID, pt.Key, account.Name), pt.Template, templateVars)
+	return templateVars, nil
 }
 
-func (pt *PolicyTemplate) renderServiceRole(c *Container, account *Account, vars map[string]string) (*IAMPolicyDoc, error) {
-	if pt.ServiceRole == nil {
-		return nil, nil
+func (s *templateSpec) renderContext(c *Container, account *Account) *renderContext {
+	return &renderContext{
+		amper:     s.pt.amper,
+		container: c,
+		account:   account,
 	}
+}
 
-	templateVars := map[string]interface{}{
-		"container": c,
-		"account":   account,
-		"vars":      vars,
+func (s *templateSpec) renderTemplate(c *Container, account *Account, vars map[string]interface{}) (*IAMPolicyDoc, error) {
+	templateVars, err := s.templateVars(c, account, vars)
+
+	if err != nil {
+		return nil, err
 	}
 
-	for k, v := range pt.Consts {
-		templateVars[k] = v
+	ctx := s.renderContext(c, account)
+
+	pd, err := s.pt.render(fmt.Sprintf("container=%s,template=%s,account=%s", c.ID, s.pt.Key, account.Name), s.format, s.template, templateVars, ctx)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return pt.render(fmt.Sprintf("service_role:container=%s,template=%s,account=%s", c.ID, pt.Key, account.Name), pt.ServiceRole.Template, templateVars)
+	if err = s.renderPartials(pd, templateVars, ctx); err != nil {
+		return nil, err
+	}
+
+	return pd, nil
 }
 
-func (pt *PolicyTemplate) renderServiceAssumeRole(c *Container, account *Account, vars map[string]string) (*IAMPolicyDoc, error) {
-	if pt.ServiceRole == nil {
+func (s *templateSpec) renderServiceRole(c *Container, account *Account, vars map[string]interface{}) (*IAMPolicyDoc, error) {
+	if s.serviceRole == nil {
 		return nil, nil
 	}
 
-	templateVars := map[string]interface{}{
-		"container": c,
-		"account":   account,
-		"vars":      vars,
+	templateVars, err := s.templateVars(c, account, vars)
+
+	if err != nil {
+		return nil, err
 	}
 
-	for k, v := range pt.Consts {
-		templateVars[k] = v
+	return s.pt.render(fmt.Sprintf("service_role:container=%s,template=%s,account=%s", c.ID, s.pt.Key, account.Name), s.format, s.serviceRole.Template, templateVars, s.renderContext(c, account))
+}
+
+func (s *templateSpec) renderServiceAssumeRole(c *Container, account *Account, vars map[string]interface{}) (*IAMPolicyDoc, error) {
+	if s.serviceRole == nil {
+		return nil, nil
+	}
+
+	templateVars, err := s.templateVars(c, account, vars)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return pt.render(fmt.Sprintf("service_role:container=%s,template=%s,account=%s", c.ID, pt.Key, account.Name), pt.ServiceRole.AssumeRoleTemplate, templateVars)
+	return s.pt.render(fmt.Sprintf("service_role:container=%s,template=%s,account=%s", c.ID, s.pt.Key, account.Name), s.format, s.serviceRole.AssumeRoleTemplate, templateVars, s.renderContext(c, account))
 }
 
-func (pt *PolicyTemplate) fetchTemplate() (*string, error) {
-	if pt.amper.S3 == nil || pt.amper.StateBucket == "" || pt.amper.KeyFormat == "" {
-		return nil, fmt.Errorf("S3 configuration not found")
+// fetchTemplate fetches template for given account from TemplateSource.
+// Key formats are tried in order, first found template is returned.
+// Pinned version is fetched only for the first existing key, it's an
+// error, if version of that key is not found.
+func (pt *PolicyTemplate) fetchTemplate(account *Account, versionID string) (*FetchedTemplate, error) {
+	if pt.amper.TemplateSource == nil || len(pt.amper.KeyFormats) == 0 {
+		return nil, fmt.Errorf("template source configuration not found")
 	}
 
-	var key = fmt.Sprintf(pt.amper.KeyFormat, pt.container.ID, pt.Key)
+	if pt.fetched == nil {
+		pt.fetched = make(map[string]*FetchedTemplate)
+	}
 
-	objInfo, err := pt.amper.S3.HeadObject(&s3.HeadObjectInput{
-		Bucket: aws.String(pt.amper.StateBucket),
-		Key:    aws.String(key),
-	})
+	for _, format := range pt.amper.KeyFormats {
+		key, ok := FormatTemplateKey(format, pt.container.ID, pt.Key, account)
 
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
-			return nil, nil
+		if !ok {
+			continue
+		}
+
+		tpl, err := pt.fetchKey(key, "")
+
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed reading S3 object '%s': %s", key, err)
+
+		if tpl == nil {
+			continue
+		}
+
+		if versionID != "" && tpl.VersionID != versionID {
+			if tpl, err = pt.fetchKey(key, versionID); err != nil {
+				return nil, err
+			}
+
+			if tpl == nil {
+				return nil, fmt.Errorf("version '%s' of template '%s' not found", versionID, key)
+			}
+		}
+
+		if err = pt.checkTemplate(tpl); err != nil {
+			return nil, err
+		}
+
+		return tpl, nil
+	}
+
+	if versionID != "" {
+		return nil, fmt.Errorf("template '%s' with version '%s' not found", pt.Key, versionID)
 	}
 
-	if *objInfo.ContentLength > 65536 {
-		return nil, fmt.Errorf("failed reading S3 object '%s', too big %dbytes", key, *objInfo.ContentLength)
+	return nil, nil
+}
+
+// fetchKey fetches and caches version of template key.
+func (pt *PolicyTemplate) fetchKey(key, versionID string) (*FetchedTemplate, error) {
+	cacheKey := key + "@" + versionID
+
+	if tpl, ok := pt.fetched[cacheKey]; ok {
+		return tpl, nil
 	}
 
-	out, err := pt.amper.S3.GetObject(&s3.GetObjectInput{
-		Bucket:    aws.String(pt.amper.StateBucket),
-		Key:       aws.String(key),
-		VersionId: objInfo.VersionId,
-	})
+	tpl, err := pt.amper.TemplateSource.Fetch(key, versionID)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed reading S3 object '%s': %s", key, err)
+		return nil, err
 	}
 
-	buf := new(bytes.Buffer)
+	pt.fetched[cacheKey] = tpl
 
-	_, err = buf.ReadFrom(out.Body)
+	return tpl, nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("Failed reading content of S3 object '%s': %s", key, err)
+// checkTemplate verifies fetched template and parses its front-matter.
+func (pt *PolicyTemplate) checkTemplate(tpl *FetchedTemplate) (err error) {
+	if tpl.checked {
+		return nil
+	}
+
+	if err = pt.verifyTemplate(tpl); err != nil {
+		return err
 	}
 
-	return aws.String(buf.String()), nil
+	if tpl.Meta, tpl.Body, err = parseFrontMatter(tpl.Content); err != nil {
+		return fmt.Errorf("invalid template '%s': %s", tpl.Key, err)
+	}
+
+	tpl.checked = true
+
+	return nil
 }
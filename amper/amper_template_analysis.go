@@ -0,0 +1,200 @@
+package amper
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateVarRefs returns names of variables referenced in template
+// as .vars.name, $.vars.name or index .vars "name". Templates included
+// with {{ template "name" }} are analyzed as well.
+func templateVarRefs(tpl *template.Template) map[string]bool {
+	w := &varRefsWalker{
+		tpl:     tpl,
+		refs:    make(map[string]bool),
+		visited: map[string]bool{tpl.Name(): true},
+	}
+
+	if tpl.Tree != nil {
+		w.walk(tpl.Tree.Root)
+	}
+
+	return w.refs
+}
+
+type varRefsWalker struct {
+	tpl     *template.Template
+	refs    map[string]bool
+	visited map[string]bool
+}
+
+func (w *varRefsWalker) walk(node parse.Node) {
+	walkVarRefs(node, w.refs, w.include)
+}
+
+// include walks template included by name, only once.
+func (w *varRefsWalker) include(name string) {
+	if w.visited[name] {
+		return
+	}
+
+	w.visited[name] = true
+
+	if t := w.tpl.Lookup(name); t != nil && t.Tree != nil {
+		w.walk(t.Tree.Root)
+	}
+}
+
+func walkVarRefs(node parse.Node, refs map[string]bool, include func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walkVarRefs(c, refs, include)
+		}
+	case *parse.ActionNode:
+		walkVarRefs(n.Pipe, refs, include)
+	case *parse.IfNode:
+		walkVarRefs(&n.BranchNode, refs, include)
+	case *parse.RangeNode:
+		walkVarRefs(&n.BranchNode, refs, include)
+	case *parse.WithNode:
+		walkVarRefs(&n.BranchNode, refs, include)
+	case *parse.BranchNode:
+		walkVarRefs(n.Pipe, refs, include)
+		walkVarRefs(n.List, refs, include)
+		walkVarRefs(n.ElseList, refs, include)
+	case *parse.TemplateNode:
+		include(n.Name)
+		walkVarRefs(n.Pipe, refs, include)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			walkVarRefs(c, refs, include)
+		}
+	case *parse.CommandNode:
+		// index .vars "name"
+		if len(n.Args) >= 3 {
+			if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "index" && isVarsNode(n.Args[1]) {
+				if s, ok := n.Args[2].(*parse.StringNode); ok {
+					refs[s.Text] = true
+				}
+			}
+		}
+		for _, c := range n.Args {
+			walkVarRefs(c, refs, include)
+		}
+	case *parse.ChainNode:
+		if isVarsNode(n.Node) && len(n.Field) > 0 {
+			refs[n.Field[0]] = true
+		}
+		walkVarRefs(n.Node, refs, include)
+	case *parse.FieldNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "vars" {
+			refs[n.Ident[1]] = true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 2 && n.Ident[0] == "$" && n.Ident[1] == "vars" {
+			refs[n.Ident[2]] = true
+		}
+	}
+}
+
+// isVarsNode checks, if node is .vars or $.vars.
+func isVarsNode(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		return len(n.Ident) == 1 && n.Ident[0] == "vars"
+	case *parse.VariableNode:
+		return len(n.Ident) == 2 && n.Ident[0] == "$" && n.Ident[1] == "vars"
+	case *parse.PipeNode:
+		return len(n.Cmds) == 1 && len(n.Cmds[0].Args) == 1 && isVarsNode(n.Cmds[0].Args[0])
+	}
+	return false
+}
+
+// analyzeVars compares variables referenced in templates of spec with
+// declared variables. If InferVars is set, undeclared variables are
+// added to spec as required, otherwise warnings are returned for them.
+// Warnings are returned for declared, but not used variables as well.
+func (s *templateSpec) analyzeVars() ([]string, error) {
+	refs := make(map[string]bool)
+
+	type text struct {
+		format string
+		txt    *string
+	}
+
+	texts := []text{{s.format, s.template}}
+
+	if s.serviceRole != nil {
+		texts = append(texts, text{s.format, s.serviceRole.Template}, text{s.format, s.serviceRole.AssumeRoleTemplate})
+	}
+
+	ctx := &renderContext{amper: s.pt.amper}
+
+	for _, name := range s.partials {
+		p, err := ctx.partial(name)
+
+		if err != nil {
+			return nil, fmt.Errorf("policy template '%s': %s", s.pt.Key, err)
+		}
+
+		texts = append(texts, text{p.Format, &p.Template})
+	}
+
+	for _, t := range texts {
+		if t.txt == nil {
+			continue
+		}
+
+		txts, err := templateTexts(t.format, *t.txt)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid data template '%s': %s", s.pt.Key, err)
+		}
+
+		for _, txt := range txts {
+			tpl, err := parseTemplate(s.pt.Key, txt, ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for name := range templateVarRefs(tpl) {
+				refs[name] = true
+			}
+		}
+	}
+
+	var warnings []string
+
+	for name := range refs {
+		if s.variables[name] != nil {
+			continue
+		}
+
+		if s.pt.InferVars {
+			s.variables[name] = &Variable{Name: name, untyped: true}
+			continue
+		}
+
+		warnings = append(warnings, fmt.Sprintf("variable '%s' is used, but not declared in policy template '%s'", name, s.pt.Key))
+	}
+
+	for name := range s.variables {
+		if !refs[name] {
+			warnings = append(warnings, fmt.Sprintf("variable '%s' is declared, but not used in policy template '%s'", name, s.pt.Key))
+		}
+	}
+
+	sort.Strings(warnings)
+
+	return warnings, nil
+}
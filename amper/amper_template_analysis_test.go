@@ -0,0 +1,110 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestTemplateVarRefs(t *testing.T) {
+	tpl, err := parseTemplate("test", `{{ define "part" }}{{ .vars.part }}{{ end }}
+{{ .vars.bucket }} {{ $.vars.prefix | upper }} {{ index .vars "region" }}
+{{ range $b := .vars.buckets }}{{ $b }}{{ $.vars.suffix }}{{ end }}
+{{ if (.vars).flag }}{{ template "part" . }}{{ end }}`, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := templateVarRefs(tpl)
+
+	var names []string
+
+	for name := range refs {
+		names = append(names, name)
+	}
+
+	if len(names) != 7 {
+		t.Fatalf("unexpected references %v", names)
+	}
+
+	for _, name := range []string{"part", "bucket", "prefix", "region", "buckets", "suffix", "flag"} {
+		if !refs[name] {
+			t.Fatalf("reference to '%s' not found in %v", name, names)
+		}
+	}
+}
+
+func TestAnalyzeVars(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := aws.String(`{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "arn:aws:s3:::{{ .vars.bucket }}/{{ .vars.prefix }}*"}]}`)
+
+	if err = root.AddPolicyTemplate(&PolicyTemplate{Key: "declared", Vars: []string{"bucket", "unused"}, Template: template}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = root.AddPolicyTemplate(&PolicyTemplate{Key: "inferred", InferVars: true, Template: template}); err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]interface{}{"bucket": "b1", "unused": "u", "prefix": "p"}
+
+	if _, err = c1.AddAttachment("declared", "sub-account-1", vars); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c1.AddAttachment("inferred", "sub-account-1", vars); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c1.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"variable 'prefix' is used, but not declared in policy template 'declared'",
+		"variable 'unused' is declared, but not used in policy template 'declared'",
+	}
+
+	if strings.Join(policy.Warnings, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected warnings %v", policy.Warnings)
+	}
+
+	c2, err := amper.NewContainer("c2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c2.AddAttachment("inferred", "sub-account-1", map[string]interface{}{"bucket": "b1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err, _ = c2.Policy(); err == nil {
+		t.Fatal("expected error for missing inferred variable")
+	}
+}
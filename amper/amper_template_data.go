@@ -0,0 +1,300 @@
+package amper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Keys of statements in data templates, which control expansion
+// of statement and are not part of IAM policy statement.
+const (
+	DataForEachKey = "for_each"
+	DataWhenKey    = "when"
+)
+
+// dataTemplate is policy template in TemplateFormatData. It's not
+// rendered as text, but statements are expanded directly into
+// IAMPolicyStatements. Each string in statement is rendered as
+// separate template. For example:
+//
+//	Statement:
+//	  - for_each: buckets
+//	    when: eq .account.ShortName "prod"
+//	    Effect: Allow
+//	    Action: s3:GetObject
+//	    Resource: '{{ arn "s3" .each }}/*'
+//
+// for_each is the name of list variable or literal list, statement
+// is repeated for each element of list, which is available as .each.
+// when is template expression, statement is included only, if it
+// evaluates to true.
+type dataTemplate struct {
+	Version   string                   `yaml:"Version"`
+	Id        string                   `yaml:"Id"`
+	Statement []map[string]interface{} `yaml:"Statement"`
+}
+
+func parseDataTemplate(txt string) (*dataTemplate, error) {
+	d := &dataTemplate{}
+
+	if err := yaml.UnmarshalStrict([]byte(txt), d); err != nil {
+		return nil, err
+	}
+
+	for _, s := range d.Statement {
+		for k, v := range s {
+			s[k] = normalizeYAML(v)
+		}
+	}
+
+	return d, nil
+}
+
+// texts returns all template texts of data template, including
+// expressions of for_each and when. It's used for analysis of
+// referenced variables.
+func (d *dataTemplate) texts() []string {
+	var res []string
+
+	var walk func(v interface{})
+
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			res = append(res, v)
+		case map[string]interface{}:
+			for k, e := range v {
+				res = append(res, k)
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+
+	for _, s := range d.Statement {
+		for k, v := range s {
+			switch k {
+			case DataForEachKey:
+				if name, ok := v.(string); ok {
+					res = append(res, fmt.Sprintf("{{ .vars.%s }}", name))
+				}
+			case DataWhenKey:
+				res = append(res, fmt.Sprintf("{{ %v }}", v))
+			default:
+				walk(v)
+			}
+		}
+	}
+
+	return res
+}
+
+// templateTexts returns texts of template in given format,
+// which are parsed as Go templates.
+func templateTexts(format, txt string) ([]string, error) {
+	if format != TemplateFormatData {
+		return []string{txt}, nil
+	}
+
+	d, err := parseDataTemplate(txt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.texts(), nil
+}
+
+// renderData expands statements of data template.
+func (pt *PolicyTemplate) renderData(name, txt string, vars map[string]interface{}, ctx *renderContext) (*IAMPolicyDoc, error) {
+	d, err := parseDataTemplate(txt)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid data template %s: %s", name, err)
+	}
+
+	pd := &IAMPolicyDoc{
+		Version: d.Version,
+		Id:      d.Id,
+	}
+
+	for i, stmt := range d.Statement {
+		sname := fmt.Sprintf("%s,statement=%d", name, i)
+
+		each, err := dataForEach(stmt[DataForEachKey], vars)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", sname, DataForEachKey, err)
+		}
+
+		for _, e := range each {
+			data := vars
+
+			if _, ok := stmt[DataForEachKey]; ok {
+				data = make(map[string]interface{}, len(vars)+1)
+
+				for k, v := range vars {
+					data[k] = v
+				}
+
+				data["each"] = e
+			}
+
+			if when, ok := stmt[DataWhenKey]; ok {
+				res, err := pt.execute(sname, fmt.Sprintf("{{ %v }}", when), data, ctx)
+
+				if err != nil {
+					return nil, err
+				}
+
+				include, err := strconv.ParseBool(strings.TrimSpace(string(res)))
+
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s must evaluate to boolean, got '%s'", sname, DataWhenKey, res)
+				}
+
+				if !include {
+					continue
+				}
+			}
+
+			s, err := pt.renderDataStatement(sname, stmt, data, ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			pd.Statements = append(pd.Statements, s)
+		}
+	}
+
+	return pd, nil
+}
+
+// dataForEach returns list of elements to iterate over. If for_each
+// is not set, list with single nil element is returned.
+func dataForEach(forEach interface{}, vars map[string]interface{}) ([]interface{}, error) {
+	if forEach == nil {
+		return []interface{}{nil}, nil
+	}
+
+	if name, ok := forEach.(string); ok {
+		v, _ := vars["vars"].(map[string]interface{})
+
+		if forEach, ok = v[name]; !ok {
+			return nil, fmt.Errorf("variable '%s' is not set", name)
+		}
+	}
+
+	list := reflect.ValueOf(forEach)
+
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected list, got %T", forEach)
+	}
+
+	res := make([]interface{}, 0, list.Len())
+
+	for i := 0; i < list.Len(); i++ {
+		res = append(res, list.Index(i).Interface())
+	}
+
+	return res, nil
+}
+
+// renderDataStatement renders all strings of statement and decodes
+// it into IAMPolicyStatement.
+func (pt *PolicyTemplate) renderDataStatement(name string, stmt map[string]interface{}, data map[string]interface{}, ctx *renderContext) (*IAMPolicyStatement, error) {
+	raw := make(map[string]interface{}, len(stmt))
+
+	for k, v := range stmt {
+		if k == DataForEachKey || k == DataWhenKey {
+			continue
+		}
+
+		raw[k] = v
+	}
+
+	v, err := pt.renderDataValue(name, raw, data, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stringifyConditions(v.(map[string]interface{}))
+
+	buf, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+
+	s := &IAMPolicyStatement{}
+
+	if err = dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("invalid statement %s: %s", name, err)
+	}
+
+	return s, nil
+}
+
+// renderDataValue renders strings in value, including keys of maps.
+func (pt *PolicyTemplate) renderDataValue(name string, v interface{}, data map[string]interface{}, ctx *renderContext) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+
+		res, err := pt.execute(name, v, data, ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return string(res), nil
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+
+		for k, e := range v {
+			rk, err := pt.renderDataValue(name, k, data, ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if res[rk.(string)], err = pt.renderDataValue(name, e, data, ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, 0, len(v))
+
+		for _, e := range v {
+			re, err := pt.renderDataValue(name, e, data, ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, re)
+		}
+
+		return res, nil
+	}
+
+	return v, nil
+}
@@ -0,0 +1,160 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const testDataTemplate = `
+Statement:
+  - for_each: buckets
+    Sid: '{{ .each | replace "-" "" }}'
+    Effect: Allow
+    Action: ["s3:GetObject"]
+    Resource: '{{ arn "s3" .each }}/*'
+  - when: eq .account.ShortName "prod"
+    Sid: Prod
+    Effect: Allow
+    Action: s3:DeleteObject
+    Resource: "*"
+    Condition:
+      StringEquals:
+        '{{ .vars.tag }}': '{{ .account.ID }}'
+      Bool:
+        aws:SecureTransport: true
+      NumericLessThan:
+        s3:max-keys: [10, 1.5]
+  - for_each: [a, b]
+    when: ne .each "b"
+    Sid: 'Literal{{ .each }}'
+    Effect: Allow
+    Action: s3:ListBucket
+    Resource: "*"
+`
+
+func TestDataTemplate(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acc := range []*Account{
+		{ID: "111111111111", Name: "sub-account-1", ShortName: "prod"},
+		{ID: "222222222222", Name: "sub-account-2", ShortName: "dev"},
+	} {
+		if err := amper.AddAccount(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:      "data",
+		Format:   TemplateFormatData,
+		Scope:    []string{"s3:*"},
+		Template: aws.String(testDataTemplate),
+		Variables: []*Variable{
+			{Name: "buckets", Type: VarTypeList},
+			{Name: "tag", Type: VarTypeString},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, account := range []string{"sub-account-1", "sub-account-2"} {
+		if _, err = c.AddAttachment("data", account, map[string]interface{}{"buckets": []interface{}{"b-1", "b-2"}, "tag": "aws:PrincipalAccount"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(policy.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", policy.Warnings)
+	}
+
+	for account, expected := range map[string][]string{
+		"sub-account-1": {"b1", "b2", "Prod", "Literala"},
+		"sub-account-2": {"b1", "b2", "Literala"},
+	} {
+		sids := make(map[string]*IAMPolicyStatement)
+
+		for _, s := range policy.AccountPolicies[account][0].Statements {
+			sids[s.Sid] = s
+		}
+
+		for _, sid := range expected {
+			if sids[sid] == nil {
+				t.Fatalf("expected statement '%s' in account '%s'", sid, account)
+			}
+		}
+
+		if sids["Literalb"] != nil || (account == "sub-account-2" && sids["Prod"] != nil) {
+			t.Fatalf("unexpected statements in account '%s'", account)
+		}
+
+		if r := sids["b2"].Resources[0]; r != "arn:aws:s3:::b-2/*" {
+			t.Fatalf("unexpected resource '%s'", r)
+		}
+
+		if s := sids["Prod"]; s != nil && (s.Conditions["StringEquals"]["aws:PrincipalAccount"][0] != "111111111111" ||
+			s.Conditions["Bool"]["aws:SecureTransport"][0] != "true" ||
+			strings.Join(s.Conditions["NumericLessThan"]["s3:max-keys"], ",") != "10,1.5") {
+			t.Fatalf("unexpected condition %+v", s.Conditions)
+		}
+	}
+}
+
+func TestDataTemplateErrors(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		err      string
+	}{
+		{"Statement:\n  - {Effect: Allow, Actions: '*'}", `unknown field "Actions"`},
+		{"Statement:\n  - {for_each: missing, Effect: Allow}", "variable 'missing' is not set"},
+		{"Statement:\n  - {when: '\"yes\"', Effect: Allow}", "when must evaluate to boolean"},
+		{"Statements: []", "field Statements not found"},
+	} {
+		amper, err := NewKernel(&AmperConfig{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := amper.AddAccount(&Account{ID: "111111111111", Name: "sub-account-1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := amper.NewContainer("c1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = c.AddPolicyTemplate(&PolicyTemplate{Key: "data", Format: TemplateFormatData, Template: aws.String(test.template)}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = c.AddAttachment("data", "sub-account-1", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err, _ = c.Policy(); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error containing '%s', got %v", test.err, err)
+		}
+	}
+}
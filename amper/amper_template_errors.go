@@ -0,0 +1,85 @@
+package amper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonErrorContextLines is number of lines shown before and after
+// the line with JSON error.
+const jsonErrorContextLines = 2
+
+// jsonErrorOffset returns offset of JSON decoding error in input.
+func jsonErrorOffset(err error) (int64, bool) {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		return err.Offset, true
+	case *json.UnmarshalTypeError:
+		return err.Offset, true
+	}
+	return 0, false
+}
+
+// textPosition converts byte offset in data into 1-based line and column.
+func textPosition(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - (bytes.LastIndexByte(before, '\n') + 1)
+
+	if col == 0 {
+		col = 1
+	}
+
+	return
+}
+
+// textContext returns lines of data around given line, prefixed with
+// line numbers. Column of error is marked with caret.
+func textContext(data []byte, line, col int) string {
+	lines := strings.Split(string(data), "\n")
+
+	from := line - jsonErrorContextLines
+	if from < 1 {
+		from = 1
+	}
+
+	to := line + jsonErrorContextLines
+	if to > len(lines) {
+		to = len(lines)
+	}
+
+	var buf bytes.Buffer
+
+	width := len(fmt.Sprintf("%d", to))
+
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&buf, "%*d | %s\n", width, i, lines[i-1])
+
+		if i == line {
+			fmt.Fprintf(&buf, "%s | %s^\n", strings.Repeat(" ", width), strings.Repeat(" ", col-1))
+		}
+	}
+
+	return buf.String()
+}
+
+// renderedJSONError wraps error of decoding rendered template with
+// position of error and surrounding text.
+func renderedJSONError(name string, data []byte, err error) error {
+	offset, ok := jsonErrorOffset(err)
+
+	if !ok {
+		return fmt.Errorf("invalid JSON rendered by %s: %s", name, err)
+	}
+
+	line, col := textPosition(data, offset)
+
+	return fmt.Errorf("invalid JSON rendered by %s at line %d, column %d: %s\n%s", name, line, col, err, textContext(data, line, col))
+}
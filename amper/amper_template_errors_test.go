@@ -0,0 +1,82 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func testRenderError(t *testing.T, config *AmperConfig, template string, vars map[string]interface{}) error {
+	amper, err := NewKernel(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = root.AddPolicyTemplate(&PolicyTemplate{Key: "s3", Template: aws.String(template)}); err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c1.AddAttachment("s3", "sub-account-1", vars); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err, _ = c1.Policy()
+
+	return err
+}
+
+func TestRenderedJSONError(t *testing.T) {
+	err := testRenderError(t, &AmperConfig{}, `{
+  "Statement": [{
+    "Effect": "Allow",
+    "Action": "s3:*",
+    "Resource": "{{ .vars.bucket }}",
+  }]
+}`, map[string]interface{}{"bucket": "b1"})
+
+	if err == nil {
+		t.Fatal("expected JSON error")
+	}
+
+	for _, s := range []string{
+		"container=c1,template=s3,account=sub-account-1",
+		"at line 6, column 3",
+		`5 |     "Resource": "b1",`,
+		"6 |   }]",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("expected '%s' in error:\n%s", s, err)
+		}
+	}
+}
+
+func TestMissingKeyError(t *testing.T) {
+	template := `{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "{{ .vars.bukcet }}"}]}`
+	vars := map[string]interface{}{"bucket": "b1"}
+
+	if err := testRenderError(t, &AmperConfig{}, template, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testRenderError(t, &AmperConfig{MissingKeyError: true}, template, vars); err == nil || !strings.Contains(err.Error(), "bukcet") {
+		t.Fatalf("expected missing key error, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package amper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/hashicorp/hcl"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of rendered templates.
+const (
+	TemplateFormatJSON = "json"
+	TemplateFormatYAML = "yaml"
+	TemplateFormatHCL  = "hcl"
+
+	// TemplateFormatData is YAML or JSON policy, which is not rendered
+	// as text, see renderData.
+	TemplateFormatData = "data"
+)
+
+// ValidateTemplateFormat checks, if format is supported. Empty format
+// is the same as TemplateFormatJSON.
+func ValidateTemplateFormat(format string) error {
+	switch format {
+	case "", TemplateFormatJSON, TemplateFormatYAML, TemplateFormatHCL, TemplateFormatData:
+		return nil
+	}
+
+	return fmt.Errorf("unknown template format '%s', can be json, yaml, hcl or data", format)
+}
+
+// decodePolicyDoc decodes policy document rendered by template name
+// in given format. YAML and HCL documents use same keys, as JSON policy.
+func decodePolicyDoc(name, format string, data []byte) (*IAMPolicyDoc, error) {
+	var (
+		raw interface{}
+		err error
+	)
+
+	switch format {
+	case "", TemplateFormatJSON:
+		pd := &IAMPolicyDoc{}
+
+		if err = json.Unmarshal(data, pd); err != nil {
+			return nil, renderedJSONError(name, data, err)
+		}
+
+		return pd, nil
+	case TemplateFormatYAML:
+		if err = yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid YAML rendered by %s: %s", name, err)
+		}
+
+		raw = normalizeYAML(raw)
+	case TemplateFormatHCL:
+		if err = hcl.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid HCL rendered by %s: %s", name, err)
+		}
+
+		if raw, err = normalizeHCL("", raw); err != nil {
+			return nil, fmt.Errorf("invalid HCL rendered by %s: %s", name, err)
+		}
+	default:
+		return nil, ValidateTemplateFormat(format)
+	}
+
+	if doc, ok := raw.(map[string]interface{}); ok {
+		switch statements := doc["Statement"].(type) {
+		case []interface{}:
+			for _, s := range statements {
+				if s, ok := s.(map[string]interface{}); ok {
+					stringifyConditions(s)
+				}
+			}
+		case map[string]interface{}:
+			stringifyConditions(statements)
+		}
+	}
+
+	data, err = json.Marshal(raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s rendered by %s: %s", format, name, err)
+	}
+
+	pd := &IAMPolicyDoc{}
+
+	if err = json.Unmarshal(data, pd); err != nil {
+		return nil, fmt.Errorf("invalid policy rendered by %s: %s", name, err)
+	}
+
+	return pd, nil
+}
+
+// stringifyConditions converts scalar condition values of statement into
+// strings. Unquoted values, like aws:SecureTransport: false, are decoded
+// by YAML and HCL parsers as booleans or numbers, while policy has only
+// string values.
+func stringifyConditions(s map[string]interface{}) {
+	conditions, ok := s["Condition"].(map[string]interface{})
+
+	if !ok {
+		return
+	}
+
+	for _, keys := range conditions {
+		keys, ok := keys.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		for k, v := range keys {
+			if values, ok := v.([]interface{}); ok {
+				for i, e := range values {
+					values[i] = scalarString(e)
+				}
+			} else {
+				keys[k] = scalarString(v)
+			}
+		}
+	}
+}
+
+// scalarString converts booleans and numbers into strings,
+// other values are returned unchanged.
+func scalarString(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return v
+}
+
+// normalizeHCL converts blocks decoded by HCL parser, which are always
+// lists of objects, into single objects. Only Statement blocks are kept
+// as list. Repeated blocks, like Condition, are merged recursively,
+// see mergeHCL.
+func normalizeHCL(key string, v interface{}) (interface{}, error) {
+	var err error
+
+	switch v := v.(type) {
+	case []map[string]interface{}:
+		if key == "Statement" {
+			res := make([]interface{}, 0, len(v))
+
+			for _, e := range v {
+				n, err := normalizeHCL("", e)
+
+				if err != nil {
+					return nil, err
+				}
+
+				res = append(res, n)
+			}
+
+			return res, nil
+		}
+
+		res := make(map[string]interface{})
+
+		for _, e := range v {
+			for k, f := range e {
+				n, err := normalizeHCL(k, f)
+
+				if err != nil {
+					return nil, err
+				}
+
+				if res[k], err = mergeHCL(k, res[k], n); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return res, nil
+	case map[string]interface{}:
+		for k, e := range v {
+			if v[k], err = normalizeHCL(k, e); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			if v[i], err = normalizeHCL("", e); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// mergeHCL merges value b of key into value a of repeated block. Objects
+// are merged recursively, so condition keys of repeated operators are
+// kept. Different values of same key are conflicts.
+func mergeHCL(key string, a, b interface{}) (interface{}, error) {
+	if a == nil {
+		return b, nil
+	}
+
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return a, nil
+		}
+
+		return nil, fmt.Errorf("conflicting values of '%s' in repeated blocks", key)
+	}
+
+	for k, v := range bm {
+		merged, err := mergeHCL(k, am[k], v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		am[k] = merged
+	}
+
+	return am, nil
+}
@@ -0,0 +1,219 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestTemplateFormats(t *testing.T) {
+	templates := map[string]string{
+		TemplateFormatYAML: `
+Statement:
+{{- range .vars.buckets }}
+  - Sid: {{ . }}
+    Effect: Allow
+    Action: ["s3:GetObject", "s3:PutObject"]
+    Resource: arn:aws:s3:::{{ . }}/*
+    Condition:
+      StringEquals:
+        aws:RequestedRegion: eu-west-1
+{{- end }}
+`,
+		TemplateFormatHCL: `
+{{- range .vars.buckets }}
+Statement {
+  Sid = "{{ . }}"
+  Effect = "Allow"
+  Action = ["s3:GetObject", "s3:PutObject"]
+  Resource = "arn:aws:s3:::{{ . }}/*"
+  Condition {
+    StringEquals {
+      "aws:RequestedRegion" = "eu-west-1"
+    }
+  }
+}
+{{- end }}
+`,
+	}
+
+	for format, tpl := range templates {
+		amper, err := NewKernel(&AmperConfig{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := amper.AddAccount(&Account{ID: "111111111111", Name: "sub-account-1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := amper.NewContainer("c1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.AddPolicyTemplate(&PolicyTemplate{
+			Key:      "formats",
+			Format:   format,
+			Scope:    []string{"s3:*"},
+			Template: aws.String(tpl),
+			Variables: []*Variable{
+				{Name: "buckets", Type: VarTypeList},
+			},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = c.AddAttachment("formats", "sub-account-1", map[string]interface{}{"buckets": []interface{}{"b1", "b2"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		policy, err, _ := c.Policy()
+
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		var statements []*IAMPolicyStatement
+
+		for _, s := range policy.AccountPolicies["sub-account-1"][0].Statements {
+			if s.Sid == "b1" || s.Sid == "b2" {
+				statements = append(statements, s)
+			}
+		}
+
+		if len(statements) != 2 {
+			t.Fatalf("%s: expected 2 statements, got %d", format, len(statements))
+		}
+
+		s := statements[1]
+
+		if len(s.Actions) != 2 || s.Resources[0] != "arn:aws:s3:::b2/*" || s.Conditions["StringEquals"]["aws:RequestedRegion"][0] != "eu-west-1" {
+			t.Fatalf("%s: unexpected statement %+v", format, s)
+		}
+	}
+
+	k, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = k.AddPartial(&Partial{Name: "p", Format: "xml"}); err == nil || !strings.Contains(err.Error(), "unknown template format") {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+
+	if _, err := decodePolicyDoc("test", TemplateFormatYAML, []byte("Statement: [")); err == nil || !strings.Contains(err.Error(), "invalid YAML rendered by test") {
+		t.Fatalf("expected YAML error, got %v", err)
+	}
+}
+
+func TestTemplateFormatScalarConditions(t *testing.T) {
+	docs := map[string]string{
+		TemplateFormatYAML: `
+Statement:
+  - Effect: Deny
+    Action: "s3:*"
+    Resource: "*"
+    Condition:
+      Bool:
+        aws:SecureTransport: false
+      NumericLessThan:
+        s3:TlsVersion: 1.2
+      NumericEquals:
+        s3:max-keys: [10, 20]
+`,
+		TemplateFormatHCL: `
+Statement {
+  Effect = "Deny"
+  Action = "s3:*"
+  Resource = "*"
+  Condition {
+    Bool {
+      "aws:SecureTransport" = false
+    }
+    NumericLessThan {
+      "s3:TlsVersion" = 1.2
+    }
+    NumericEquals {
+      "s3:max-keys" = [10, 20]
+    }
+  }
+}
+`,
+	}
+
+	for format, doc := range docs {
+		pd, err := decodePolicyDoc("test", format, []byte(doc))
+
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		c := pd.Statements[0].Conditions
+
+		if c["Bool"]["aws:SecureTransport"][0] != "false" || c["NumericLessThan"]["s3:TlsVersion"][0] != "1.2" || strings.Join(c["NumericEquals"]["s3:max-keys"], ",") != "10,20" {
+			t.Fatalf("%s: unexpected conditions %+v", format, c)
+		}
+	}
+}
+
+func TestTemplateFormatHCLRepeatedBlocks(t *testing.T) {
+	pd, err := decodePolicyDoc("test", TemplateFormatHCL, []byte(`
+Statement {
+  Effect = "Allow"
+  Action = "s3:GetObject"
+  Resource = "*"
+  Condition {
+    StringEquals {
+      "aws:a" = "x"
+    }
+  }
+  Condition {
+    StringEquals {
+      "aws:b" = "y"
+    }
+    StringEquals {
+      "aws:c" = "z"
+    }
+  }
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := pd.Statements[0].Conditions["StringEquals"]
+
+	if len(c) != 3 || c["aws:a"][0] != "x" || c["aws:b"][0] != "y" || c["aws:c"][0] != "z" {
+		t.Fatalf("unexpected conditions %+v", pd.Statements[0].Conditions)
+	}
+
+	_, err = decodePolicyDoc("test", TemplateFormatHCL, []byte(`
+Statement {
+  Effect = "Allow"
+  Action = "s3:GetObject"
+  Resource = "*"
+  Condition {
+    StringEquals {
+      "aws:a" = "x"
+    }
+  }
+  Condition {
+    StringEquals {
+      "aws:a" = "y"
+    }
+  }
+}
+`))
+
+	if err == nil || !strings.Contains(err.Error(), "conflicting values of 'aws:a'") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
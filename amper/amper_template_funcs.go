@@ -0,0 +1,224 @@
+package amper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+)
+
+// DefaultPartition is AWS partition of accounts without partition.
+const DefaultPartition = "aws"
+
+// Partitions lists known AWS partitions.
+var Partitions = []string{DefaultPartition, "aws-cn", "aws-us-gov"}
+
+func isPartition(partition string) bool {
+	for _, p := range Partitions {
+		if p == partition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultRoleNameFormat is the format of container's role name.
+const DefaultRoleNameFormat = "{container}"
+
+// arnServices lists services with ARNs, which don't follow
+// arn:partition:service:region:account-id:resource format.
+var arnServices = map[string]struct {
+	global      bool
+	accountless bool
+}{
+	"s3":            {global: true, accountless: true},
+	"route53":       {global: true, accountless: true},
+	"iam":           {global: true},
+	"sts":           {global: true},
+	"cloudfront":    {global: true},
+	"organizations": {global: true},
+}
+
+// sandboxedFuncs lists functions removed from templates in sandbox mode,
+// in addition to sprig's non-hermetic functions (env, expandenv, now,
+// random generators, etc.).
+var sandboxedFuncs = []string{
+	// Depend on current time or local time zone
+	"ago",
+	"toDate",
+
+	// Random
+	"shuffle",
+	"genPrivateKey",
+	"genCA",
+	"genSelfSignedCert",
+	"genSignedCert",
+
+	// Depend on map iteration order
+	"keys",
+	"values",
+}
+
+// renderContext is the context, in which template is rendered.
+type renderContext struct {
+	amper     *Kernel
+	container *Container
+	account   *Account
+}
+
+// funcMap returns functions available in templates. Functions are bound
+// to context, so funcMap of nil context can be used only for parsing.
+func (ctx *renderContext) funcMap() template.FuncMap {
+	var funcs template.FuncMap
+
+	if ctx != nil && ctx.amper != nil && ctx.amper.SandboxFuncs {
+		funcs = sprig.HermeticTxtFuncMap()
+
+		for _, name := range sandboxedFuncs {
+			delete(funcs, name)
+		}
+	} else {
+		funcs = sprig.TxtFuncMap()
+	}
+
+	funcs["arn"] = ctx.arn
+	funcs["partition"] = ctx.partition
+	funcs["account"] = ctx.lookupAccount
+	funcs["roleArn"] = ctx.roleArn
+	funcs["containerId"] = ctx.containerID
+	funcs["jsonList"] = jsonList
+
+	return funcs
+}
+
+// arn builds ARN of resource of service in current account.
+// Region defaults to "*" for regional services.
+func (ctx *renderContext) arn(service, resource string, region ...string) (string, error) {
+	if len(region) > 1 {
+		return "", fmt.Errorf("arn: too many arguments")
+	}
+
+	var (
+		r  = "*"
+		id = ctx.account.ID
+	)
+
+	if len(region) == 1 {
+		r = region[0]
+	}
+
+	if s, ok := arnServices[service]; ok {
+		if s.global && len(region) == 0 {
+			r = ""
+		}
+		if s.accountless {
+			id = ""
+		}
+	}
+
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s", ctx.account.PartitionName(), service, r, id, resource), nil
+}
+
+// lookupAccount returns registered account by name, ID or short name.
+// Kernel is already locked during rendering.
+func (ctx *renderContext) lookupAccount(name string) (*Account, error) {
+	account, ok := ctx.amper.findAccount(name)
+
+	if !ok {
+		return nil, fmt.Errorf("account: unknown account '%s'", name)
+	}
+
+	return account, nil
+}
+
+// roleArn returns ARN of container's role in given account,
+// current account is used by default.
+func (ctx *renderContext) roleArn(accountName ...string) (string, error) {
+	account := ctx.account
+
+	if len(accountName) > 1 {
+		return "", fmt.Errorf("roleArn: too many arguments")
+	}
+
+	if len(accountName) == 1 {
+		var err error
+
+		if account, err = ctx.lookupAccount(accountName[0]); err != nil {
+			return "", err
+		}
+	}
+
+	name, err := ctx.amper.RoleName(ctx.container.ID, account)
+
+	if err != nil {
+		return "", fmt.Errorf("roleArn: %s", err)
+	}
+
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", account.PartitionName(), account.ID, name), nil
+}
+
+// partition returns partition of current account.
+func (ctx *renderContext) partition() string {
+	return ctx.account.PartitionName()
+}
+
+func (ctx *renderContext) containerID() string {
+	return ctx.container.ID
+}
+
+// jsonList returns JSON array of arguments. Single list argument
+// is encoded as is.
+func jsonList(args ...interface{}) (string, error) {
+	list := args
+
+	if len(args) == 1 && args[0] != nil {
+		if v := reflect.ValueOf(args[0]); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			list = make([]interface{}, 0, v.Len())
+
+			for i := 0; i < v.Len(); i++ {
+				list = append(list, v.Index(i).Interface())
+			}
+		}
+	}
+
+	if list == nil {
+		list = []interface{}{}
+	}
+
+	data, err := json.Marshal(list)
+
+	if err != nil {
+		return "", fmt.Errorf("jsonList: %s", err)
+	}
+
+	return string(data), nil
+}
+
+// RoleName returns name of container's role in account. Placeholders,
+// which are empty for account, are errors.
+func (a *Kernel) RoleName(containerID string, account *Account) (string, error) {
+	format := a.RoleNameFormat
+
+	if format == "" {
+		format = DefaultRoleNameFormat
+	}
+
+	placeholders := []string{
+		"{container}", containerID,
+		"{account}", account.Name,
+		"{account_short}", account.ShortName,
+		"{account_id}", account.ID,
+	}
+
+	for i := 0; i < len(placeholders); i += 2 {
+		if placeholders[i+1] == "" && strings.Contains(format, placeholders[i]) {
+			return "", fmt.Errorf("role name format '%s' refers to %s, which is empty for account '%s'", format, placeholders[i], account.Name)
+		}
+	}
+
+	return strings.NewReplacer(placeholders...).Replace(format), nil
+}
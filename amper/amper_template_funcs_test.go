@@ -0,0 +1,172 @@
+package amper
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{
+		RoleNameFormat: "{container}-{account_short}",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acc := range []*Account{
+		{ID: "111111111111", Name: "sub-account-1", ShortName: "sa1"},
+		{ID: "222222222222", Name: "sub-account-2", ShortName: "sa2"},
+	} {
+		if err := amper.AddAccount(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = root.AddPolicyTemplate(&PolicyTemplate{
+		Key:   "funcs",
+		Scope: []string{"s3:*"},
+		Template: aws.String(`{
+  "Statement": [{
+    "Sid": "{{ containerId }}",
+    "Effect": "Allow",
+    "Action": {{ jsonList "s3:GetObject" "s3:Put\"Object" }},
+    "Resource": [
+      "{{ arn "s3" "bucket/key" }}",
+      "{{ arn "sqs" "queue" }}",
+      "{{ arn "sqs" "queue" "eu-west-1" }}",
+      "{{ arn "iam" "role/x" }}",
+      "{{ (account "sub-account-2").ID }}",
+      "{{ roleArn }}",
+      "{{ roleArn "sub-account-2" }}"
+    ],
+    "NotResource": {{ jsonList .vars.buckets }}
+  }]
+}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c1.AddAttachment("funcs", "sub-account-1", map[string]interface{}{"buckets": []interface{}{"b1", "b2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c1.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := policy.AccountPolicies["sub-account-1"][0].Statements[0]
+
+	expected := []string{
+		"arn:aws:s3:::bucket/key",
+		"arn:aws:sqs:*:111111111111:queue",
+		"arn:aws:sqs:eu-west-1:111111111111:queue",
+		"arn:aws:iam::111111111111:role/x",
+		"222222222222",
+		"arn:aws:iam::111111111111:role/c1-sa1",
+		"arn:aws:iam::222222222222:role/c1-sa2",
+	}
+
+	if s.Sid != "c1" || len(s.Actions) != 2 || s.Actions[1] != `s3:Put"Object` || len(s.NotResources) != 2 {
+		t.Fatalf("unexpected statement %+v", s)
+	}
+
+	for i, r := range expected {
+		if s.Resources[i] != r {
+			t.Fatalf("expected resource %d to be '%s', got '%s'", i, r, s.Resources[i])
+		}
+	}
+
+	if _, err = amper.RoleName("c1", &Account{ID: "333333333333", Name: "sub-account-3"}); err == nil || !strings.Contains(err.Error(), "refers to {account_short}") {
+		t.Fatalf("expected empty short name error, got %v", err)
+	}
+}
+
+func TestSandboxFuncs(t *testing.T) {
+	for _, fn := range []string{"env", "expandenv", "now", "randAlpha", "uuidv4", "genPrivateKey"} {
+		amper, err := NewKernel(&AmperConfig{SandboxFuncs: true})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := amper.AddAccount(&Account{ID: "111111111111", Name: "sub-account-1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := amper.NewContainer("c1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.AddPolicyTemplate(&PolicyTemplate{
+			Key:      "sandbox",
+			Template: aws.String(`{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "{{ ` + fn + ` "x" }}"}]}`),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = c.AddAttachment("sandbox", "sub-account-1", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err, _ = c.Policy(); err == nil || !strings.Contains(err.Error(), `function "`+fn+`" not defined`) {
+			t.Fatalf("expected '%s' to be undefined, got %v", fn, err)
+		}
+	}
+
+	k, err := NewKernel(&AmperConfig{SandboxFuncs: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	funcs := (&renderContext{amper: k}).funcMap()
+
+	if funcs["arn"] == nil || funcs["upper"] == nil {
+		t.Fatal("expected amper and deterministic sprig functions to be available")
+	}
+
+	removed := make(map[string]bool)
+
+	for name := range sprig.TxtFuncMap() {
+		if funcs[name] == nil {
+			removed[name] = true
+		}
+	}
+
+	for _, name := range append([]string{"env", "now", "date", "randAlphaNum", "uuidv4"}, sandboxedFuncs...) {
+		if !removed[name] {
+			t.Fatalf("expected '%s' to be removed in sandbox mode", name)
+		}
+	}
+
+	for name := range removed {
+		if _, err = template.New("sandbox").Funcs(funcs).Parse(`{{ ` + name + ` }}`); err == nil || !strings.Contains(err.Error(), `function "`+name+`" not defined`) {
+			t.Fatalf("expected '%s' to fail to parse in sandbox mode, got %v", name, err)
+		}
+	}
+}
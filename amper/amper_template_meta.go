@@ -0,0 +1,254 @@
+package amper
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FrontMatterDelimiter opens and closes front-matter header of template.
+const FrontMatterDelimiter = "---"
+
+// ServiceRoleMeta is service role declared in template front-matter.
+type ServiceRoleMeta struct {
+	Name               string `yaml:"name"`
+	Template           string `yaml:"template"`
+	AssumeRoleTemplate string `yaml:"assume_role_template"`
+}
+
+// TemplateMeta is metadata declared in front-matter of fetched template.
+// Front-matter is YAML or JSON document, enclosed between two
+// FrontMatterDelimiter lines at the very beginning of template, which
+// declares at least one field of TemplateMeta. Otherwise leading
+// FrontMatterDelimiter is YAML document marker of template body.
+type TemplateMeta struct {
+	Format      string                 `yaml:"format"`
+	Scope       []string               `yaml:"scope"`
+	Vars        []string               `yaml:"vars"`
+	Defaults    map[string]string      `yaml:"defaults"`
+	Variables   map[string]*Variable   `yaml:"variables"`
+	Consts      map[string]interface{} `yaml:"consts"`
+	Partials    []string               `yaml:"partials"`
+	ServiceRole *ServiceRoleMeta       `yaml:"service_role"`
+}
+
+// parseFrontMatter splits template content into metadata and body.
+// If content has no front-matter, nil metadata is returned. Header,
+// which is not closed or has no fields of TemplateMeta, is part of body.
+func parseFrontMatter(content string) (*TemplateMeta, string, error) {
+	r := bufio.NewReader(strings.NewReader(content))
+
+	line, err := r.ReadString('\n')
+
+	if err != nil || strings.TrimSpace(line) != FrontMatterDelimiter {
+		return nil, content, nil
+	}
+
+	offset := len(line)
+
+	var header []string
+
+	for {
+		line, err = r.ReadString('\n')
+
+		if strings.TrimSpace(line) == FrontMatterDelimiter {
+			offset += len(line)
+			break
+		}
+
+		if err != nil {
+			return nil, content, nil
+		}
+
+		header = append(header, line)
+		offset += len(line)
+	}
+
+	if !isFrontMatter(header) {
+		return nil, content, nil
+	}
+
+	meta := &TemplateMeta{}
+
+	if err = yaml.UnmarshalStrict([]byte(strings.Join(header, "")), meta); err != nil {
+		return nil, "", fmt.Errorf("cannot parse front-matter: %s", err)
+	}
+
+	for k, v := range meta.Consts {
+		meta.Consts[k] = normalizeYAML(v)
+	}
+
+	for k, v := range meta.Variables {
+		if v == nil {
+			v = &Variable{}
+			meta.Variables[k] = v
+		}
+
+		v.Name = k
+		v.Default = normalizeYAML(v.Default)
+	}
+
+	return meta, content[offset:], nil
+}
+
+// isFrontMatter returns true, if header is YAML object with at least one
+// field of TemplateMeta.
+func isFrontMatter(header []string) bool {
+	var fields map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(strings.Join(header, "")), &fields); err != nil {
+		return false
+	}
+
+	t := reflect.TypeOf(TemplateMeta{})
+
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := fields[t.Field(i).Tag.Get("yaml")]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeYAML converts maps decoded by YAML parser into
+// map[string]interface{}, so that they can be used in same way
+// as maps decoded from JSON or terraform configuration.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+
+		for k, e := range v {
+			res[fmt.Sprintf("%v", k)] = normalizeYAML(e)
+		}
+
+		return res
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeYAML(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeYAML(e)
+		}
+	}
+
+	return v
+}
+
+// mergeStringLists returns sorted union of lists.
+func mergeStringLists(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+
+	set := make(map[string]bool, len(a)+len(b))
+
+	for _, v := range a {
+		set[v] = true
+	}
+
+	for _, v := range b {
+		set[v] = true
+	}
+
+	res := make([]string, 0, len(set))
+
+	for v := range set {
+		res = append(res, v)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+// merge merges front-matter metadata into template spec.
+// Scope and variables are merged, all other values declared in both
+// places must be equal.
+func (s *templateSpec) merge(meta *TemplateMeta) error {
+	var conflicts []string
+
+	if meta.Format != "" {
+		if err := ValidateTemplateFormat(meta.Format); err != nil {
+			return err
+		}
+
+		if s.format != "" && s.format != meta.Format {
+			conflicts = append(conflicts, "format is declared differently in front-matter and policy template")
+		} else {
+			s.format = meta.Format
+		}
+	}
+
+	s.scope = mergeStringLists(s.scope, meta.Scope)
+	s.partials = mergeStringLists(s.partials, meta.Partials)
+
+	variables := make([]*Variable, 0, len(meta.Variables))
+
+	for _, v := range meta.Variables {
+		variables = append(variables, v)
+	}
+
+	metaVariables, err := templateVariables(meta.Vars, meta.Defaults, variables)
+
+	if err != nil {
+		return err
+	}
+
+	for name, v := range metaVariables {
+		if s.variables[name] == nil {
+			s.variables[name] = v
+			continue
+		}
+
+		var c []string
+
+		s.variables[name], c = mergeVariable(s.variables[name], v)
+		conflicts = append(conflicts, c...)
+	}
+
+	if len(meta.Consts) > 0 {
+		consts := make(map[string]interface{}, len(s.consts)+len(meta.Consts))
+
+		for k, v := range s.consts {
+			consts[k] = v
+		}
+
+		for k, v := range meta.Consts {
+			if c, ok := consts[k]; ok && !reflect.DeepEqual(c, v) {
+				conflicts = append(conflicts, fmt.Sprintf("const '%s' is declared differently in front-matter and policy template", k))
+				continue
+			}
+			consts[k] = v
+		}
+
+		s.consts = consts
+	}
+
+	if meta.ServiceRole != nil {
+		sr := &ServiceRoleTemplate{
+			Name:               meta.ServiceRole.Name,
+			Template:           &meta.ServiceRole.Template,
+			AssumeRoleTemplate: &meta.ServiceRole.AssumeRoleTemplate,
+		}
+
+		if s.serviceRole != nil && !reflect.DeepEqual(s.serviceRole, sr) {
+			conflicts = append(conflicts, "service role is declared differently in front-matter and policy template")
+		} else {
+			s.serviceRole = sr
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("%s", strings.Join(conflicts, "; "))
+	}
+
+	return nil
+}
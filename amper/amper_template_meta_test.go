@@ -0,0 +1,148 @@
+package amper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testFrontMatterPolicy = `---
+scope: ["s3:*"]
+vars: [bucket]
+defaults:
+  prefix: data
+consts:
+  actions: ["s3:GetObject", "s3:PutObject"]
+service_role:
+  name: copier
+  template: '{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}]}'
+  assume_role_template: '{"Statement": [{"Effect": "Allow", "Action": "sts:AssumeRole", "Principal": {"Service": "lambda.amazonaws.com"}}]}'
+---
+{
+  "Statement": [{
+    "Effect": "Allow",
+    "Action": {{ toJson .actions }},
+    "Resource": "arn:aws:s3:::{{ .vars.bucket }}/{{ .vars.prefix }}/*"
+  }]
+}`
+
+func TestParseFrontMatter(t *testing.T) {
+	meta, body, err := parseFrontMatter(testFrontMatterPolicy)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta == nil || len(meta.Scope) != 1 || meta.Vars[0] != "bucket" || meta.ServiceRole.Name != "copier" {
+		t.Fatalf("unexpected front-matter %+v", meta)
+	}
+
+	if !strings.HasPrefix(body, "{\n") {
+		t.Fatalf("unexpected template body %q", body)
+	}
+
+	if meta, body, err = parseFrontMatter(`{"Statement": []}`); err != nil || meta != nil || body != `{"Statement": []}` {
+		t.Fatalf("unexpected result for template without front-matter: %v %q %v", meta, body, err)
+	}
+
+	if _, _, err = parseFrontMatter("---\nscope: [\"s3:*\"]\nunknown: 1\n---\n{}"); err == nil {
+		t.Fatal("expected error for unknown front-matter field")
+	}
+
+	// YAML documents starting with document marker have no front-matter.
+	for _, content := range []string{
+		"---\nStatement:\n  - {Effect: Allow, Action: \"*\", Resource: \"*\"}\n",
+		"---\nVersion: \"2012-10-17\"\n---\nStatement: []\n",
+	} {
+		if meta, body, err = parseFrontMatter(content); err != nil || meta != nil || body != content {
+			t.Fatalf("unexpected result for YAML document %q: %v %q %v", content, meta, body, err)
+		}
+	}
+}
+
+func TestFrontMatterMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "policies", "root"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "policies", "root", "s3.json.tpl"), []byte(testFrontMatterPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newKernel := func(pt *PolicyTemplate, vars map[string]interface{}) (*Policy, error) {
+		amper, err := NewKernel(&AmperConfig{
+			TemplateSource: NewDirTemplateSource(dir),
+			KeyFormat:      "policies/%s/%s.json.tpl",
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := amper.AddAccount(&Account{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := amper.NewContainer("root")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = root.AddPolicyTemplate(pt); err != nil {
+			t.Fatal(err)
+		}
+
+		c1, err := amper.NewContainer("c1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = c1.AddAttachment(pt.Key, "sub-account-1", vars); err != nil {
+			t.Fatal(err)
+		}
+
+		policy, err, _ := c1.Policy()
+
+		return policy, err
+	}
+
+	policy, err := newKernel(&PolicyTemplate{Key: "s3", Scope: []string{"s3:*", "kms:*"}}, map[string]interface{}{"bucket": "b1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := policy.AccountRolePolicies["sub-account-1"][0].Statements
+
+	if s := statements[0]; s.Resources[0] != "arn:aws:s3:::b1/data/*" || len(s.Actions) != 2 {
+		t.Fatalf("unexpected statement %+v", s)
+	}
+
+	if s := statements[1]; s.Sid != "DenyUnknownServices" || strings.Join(s.NotActions, ",") != "kms:*,s3:*" {
+		t.Fatalf("unexpected deny statement %+v", s)
+	}
+
+	if _, ok := policy.ServiceRolePolicies["sub-account-1"]["copier"]; !ok {
+		t.Fatal("expected service role from front-matter")
+	}
+
+	if _, err = newKernel(&PolicyTemplate{Key: "s3"}, nil); err == nil {
+		t.Fatal("expected error for missing variable declared in front-matter")
+	}
+
+	if _, err = newKernel(&PolicyTemplate{Key: "s3", Defaults: map[string]string{"prefix": "other"}}, map[string]interface{}{"bucket": "b1"}); err == nil {
+		t.Fatal("expected error for conflicting default")
+	}
+}
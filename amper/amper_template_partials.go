@@ -0,0 +1,98 @@
+package amper
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// Partial is named template snippet, shared by all policy templates.
+// Partials can be included in templates with {{ template "name" . }},
+// or merged into rendered policy on statement level, see
+// PolicyTemplate.Partials.
+type Partial struct {
+	Name     string `yaml:"name"`
+	Template string `yaml:"template"`
+
+	// Format is the format of partial, when it's merged into policy,
+	// see PolicyTemplate.Format.
+	Format string `yaml:"format"`
+}
+
+// AddPartial registers partial in kernel.
+func (a *Kernel) AddPartial(p *Partial) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if p.Name == "" {
+		return fmt.Errorf("partial name is not set")
+	}
+
+	if err := ValidateTemplateFormat(p.Format); err != nil {
+		return fmt.Errorf("invalid partial '%s': %s", p.Name, err)
+	}
+
+	if _, ok := a.partials[p.Name]; ok {
+		return fmt.Errorf("partial '%s' already exists", p.Name)
+	}
+
+	if _, err := template.New(p.Name).Funcs((&renderContext{amper: a}).funcMap()).Parse(p.Template); err != nil {
+		return fmt.Errorf("invalid partial '%s': %s", p.Name, err)
+	}
+
+	a.partials[p.Name] = p
+
+	return nil
+}
+
+// addPartials parses all registered partials as associated templates of tpl.
+// Kernel is already locked during rendering.
+func (ctx *renderContext) addPartials(tpl *template.Template) error {
+	if ctx == nil || ctx.amper == nil {
+		return nil
+	}
+
+	for name, p := range ctx.amper.partials {
+		if name == tpl.Name() {
+			continue
+		}
+
+		if _, err := tpl.New(name).Parse(p.Template); err != nil {
+			return fmt.Errorf("invalid partial '%s': %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// partial returns registered partial by name.
+func (ctx *renderContext) partial(name string) (*Partial, error) {
+	p, ok := ctx.amper.partials[name]
+
+	if !ok {
+		return nil, fmt.Errorf("partial '%s' not found", name)
+	}
+
+	return p, nil
+}
+
+// renderPartials renders partials of template spec and merges their
+// statements into policy document.
+func (s *templateSpec) renderPartials(pd *IAMPolicyDoc, vars map[string]interface{}, ctx *renderContext) error {
+	for _, name := range s.partials {
+		p, err := ctx.partial(name)
+
+		if err != nil {
+			return fmt.Errorf("policy template '%s': %s", s.pt.Key, err)
+		}
+
+		ppd, err := s.pt.render(fmt.Sprintf("partial=%s,container=%s,template=%s,account=%s", name, ctx.container.ID, s.pt.Key, ctx.account.Name), p.Format, &p.Template, vars, ctx)
+
+		if err != nil {
+			return err
+		}
+
+		pd.Statements = append(pd.Statements, ppd.Statements...)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package amper
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestPartials(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "111111111111", Name: "sub-account-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Partial{
+		{Name: "read", Template: `{"Sid": "Read", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "{{ arn "s3" .vars.bucket }}/*"}`},
+		{Name: "kms", Template: `{"Statement": [{"Sid": "Kms", "Effect": "Allow", "Action": "kms:Decrypt", "Resource": "{{ .vars.key }}"}]}`},
+	} {
+		if err := amper.AddPartial(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := amper.AddPartial(&Partial{Name: "kms"}); err == nil {
+		t.Fatal("expected duplicate partial error")
+	}
+
+	if err := amper.AddPartial(&Partial{Name: "broken", Template: "{{ .x "}); err == nil {
+		t.Fatal("expected invalid partial error")
+	}
+
+	c, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddPolicyTemplate(&PolicyTemplate{
+		Key:      "app",
+		Vars:     []string{"bucket", "key"},
+		Scope:    []string{"s3:*", "kms:*"},
+		Partials: []string{"kms"},
+		Template: aws.String(`{"Statement": [{{ template "read" . }}]}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.AddAttachment("app", "sub-account-1", map[string]interface{}{"bucket": "b1", "key": "k1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(policy.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", policy.Warnings)
+	}
+
+	sids := make(map[string]*IAMPolicyStatement)
+
+	for _, s := range policy.AccountPolicies["sub-account-1"][0].Statements {
+		sids[s.Sid] = s
+	}
+
+	if s := sids["Read"]; s == nil || s.Resources[0] != "arn:aws:s3:::b1/*" {
+		t.Fatalf("unexpected included statement %+v", s)
+	}
+
+	if s := sids["Kms"]; s == nil || s.Resources[0] != "k1" {
+		t.Fatalf("unexpected merged statement %+v", s)
+	}
+}
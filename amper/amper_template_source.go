@@ -0,0 +1,624 @@
+package amper
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MaxTemplateSize is the maximum size of template, which can be
+// fetched from template source.
+const MaxTemplateSize = 65536
+
+// FetchedTemplate is template content fetched from TemplateSource
+// together with its provenance.
+type FetchedTemplate struct {
+	// Key is the resolved key of template in template source.
+	Key string
+
+	Content string
+
+	// Body is Content without front-matter, Meta is parsed front-matter.
+	Body string
+	Meta *TemplateMeta
+
+	// VersionID and ETag are set only by sources supporting them.
+	VersionID string
+	ETag      string
+
+	// SHA256 is hex encoded SHA256 checksum of Content.
+	SHA256 string
+
+	// SignedBy is fingerprint of the key, which signed template.
+	// Set only, if signature was verified.
+	SignedBy string
+
+	// checked is set, when template is verified and parsed.
+	checked bool
+}
+
+func newFetchedTemplate(key, content string) *FetchedTemplate {
+	sum := sha256.Sum256([]byte(content))
+
+	return &FetchedTemplate{
+		Key:     key,
+		Content: content,
+		SHA256:  hex.EncodeToString(sum[:]),
+	}
+}
+
+// TemplateSource provides content of policy templates, which are
+// not defined inline.
+type TemplateSource interface {
+	// Fetch returns template stored under key. If versionID is not
+	// empty, that specific version of template is returned.
+	// If template is not found, nil is returned without error.
+	Fetch(key, versionID string) (*FetchedTemplate, error)
+
+	// List returns keys of all templates starting with prefix.
+	List(prefix string) ([]string, error)
+}
+
+// S3TemplateSource reads templates from S3 bucket.
+type S3TemplateSource struct {
+	S3     *s3.S3
+	Bucket string
+}
+
+// NewS3TemplateSource creates template source for S3 bucket.
+func NewS3TemplateSource(s3 *s3.S3, bucket string) *S3TemplateSource {
+	return &S3TemplateSource{
+		S3:     s3,
+		Bucket: bucket,
+	}
+}
+
+func (s *S3TemplateSource) Fetch(key, versionID string) (*FetchedTemplate, error) {
+	headInput := &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}
+
+	if versionID != "" {
+		headInput.VersionId = aws.String(versionID)
+	}
+
+	objInfo, err := s.S3.HeadObject(headInput)
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "NotFound", "NoSuchKey", "NoSuchVersion":
+				// Pinned version must exist.
+				if versionID != "" {
+					return nil, fmt.Errorf("version '%s' of S3 object '%s' not found", versionID, key)
+				}
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("failed reading S3 object '%s': %s", key, err)
+	}
+
+	if *objInfo.ContentLength > MaxTemplateSize {
+		return nil, fmt.Errorf("failed reading S3 object '%s', too big %dbytes", key, *objInfo.ContentLength)
+	}
+
+	out, err := s.S3.GetObject(&s3.GetObjectInput{
+		Bucket:    aws.String(s.Bucket),
+		Key:       aws.String(key),
+		VersionId: objInfo.VersionId,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed reading S3 object '%s': %s", key, err)
+	}
+
+	defer out.Body.Close()
+
+	buf := new(bytes.Buffer)
+
+	_, err = buf.ReadFrom(out.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading content of S3 object '%s': %s", key, err)
+	}
+
+	t := newFetchedTemplate(key, buf.String())
+
+	if out.VersionId != nil {
+		t.VersionID = *out.VersionId
+	}
+
+	if out.ETag != nil {
+		t.ETag = strings.Trim(*out.ETag, `"`)
+	}
+
+	return t, nil
+}
+
+func (s *S3TemplateSource) List(prefix string) ([]string, error) {
+	var keys []string
+
+	err := s.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(out *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range out.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed listing S3 objects with prefix '%s': %s", prefix, err)
+	}
+
+	return keys, nil
+}
+
+// DirTemplateSource reads templates from local directory.
+// Template key is interpreted as slash-separated path relative to Root.
+type DirTemplateSource struct {
+	Root string
+}
+
+// NewDirTemplateSource creates template source for local directory.
+func NewDirTemplateSource(root string) *DirTemplateSource {
+	return &DirTemplateSource{
+		Root: root,
+	}
+}
+
+func (s *DirTemplateSource) Fetch(key, versionID string) (*FetchedTemplate, error) {
+	if versionID != "" {
+		return nil, fmt.Errorf("cannot fetch version '%s' of '%s', template directory is not versioned", versionID, key)
+	}
+
+	name, err := cleanTemplateKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(s.Root, filepath.FromSlash(name))
+
+	info, err := os.Stat(file)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed reading template file '%s': %s", file, err)
+	}
+
+	if info.IsDir() {
+		return nil, fmt.Errorf("failed reading template file '%s', is a directory", file)
+	}
+
+	if info.Size() > MaxTemplateSize {
+		return nil, fmt.Errorf("failed reading template file '%s', too big %dbytes", file, info.Size())
+	}
+
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed reading template file '%s': %s", file, err)
+	}
+
+	return newFetchedTemplate(key, string(data)), nil
+}
+
+func (s *DirTemplateSource) List(prefix string) ([]string, error) {
+	var keys []string
+
+	// Walk only the deepest directory, covering all keys with prefix.
+	root := filepath.Join(s.Root, filepath.FromSlash(path.Dir(prefix+"_")))
+
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == root {
+				return nil
+			}
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.Root, file)
+
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed listing template directory '%s': %s", root, err)
+	}
+
+	return keys, nil
+}
+
+// BundleTemplateSource serves templates from tar, tar.gz or zip archive.
+// Archive is loaded into memory, when source is created.
+type BundleTemplateSource struct {
+	Path string
+
+	files map[string]string
+}
+
+// NewBundleTemplateSource loads templates from archive file.
+// Zip archives are recognized by ".zip" extension, all other files
+// are read as tar archives, optionally gzip compressed.
+func NewBundleTemplateSource(file string) (*BundleTemplateSource, error) {
+	s := &BundleTemplateSource{
+		Path:  file,
+		files: make(map[string]string),
+	}
+
+	var err error
+
+	if strings.ToLower(filepath.Ext(file)) == ".zip" {
+		err = s.loadZip()
+	} else {
+		err = s.loadTar()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed loading template bundle '%s': %s", file, err)
+	}
+
+	return s, nil
+}
+
+func (s *BundleTemplateSource) add(name string, size int64, r io.Reader) error {
+	name, err := cleanTemplateKey(name)
+
+	if err != nil {
+		return err
+	}
+
+	if size > MaxTemplateSize {
+		return fmt.Errorf("template '%s' is too big %dbytes", name, size)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxTemplateSize+1))
+
+	if err != nil {
+		return fmt.Errorf("failed reading template '%s': %s", name, err)
+	}
+
+	if len(data) > MaxTemplateSize {
+		return fmt.Errorf("template '%s' is too big", name)
+	}
+
+	s.files[name] = string(data)
+
+	return nil
+}
+
+func (s *BundleTemplateSource) loadZip() error {
+	r, err := zip.OpenReader(s.Path)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+
+		if err != nil {
+			return err
+		}
+
+		err = s.add(f.Name, int64(f.UncompressedSize64), rc)
+
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *BundleTemplateSource) loadTar() error {
+	file, err := os.Open(s.Path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	br := bufio.NewReader(file)
+
+	var r io.Reader = br
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+
+		if err != nil {
+			return err
+		}
+
+		defer gz.Close()
+
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		if err = s.add(hdr.Name, hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *BundleTemplateSource) Fetch(key, versionID string) (*FetchedTemplate, error) {
+	if versionID != "" {
+		return nil, fmt.Errorf("cannot fetch version '%s' of '%s', template bundle is not versioned", versionID, key)
+	}
+
+	name, err := cleanTemplateKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := s.files[name]; ok {
+		return newFetchedTemplate(key, data), nil
+	}
+
+	return nil, nil
+}
+
+func (s *BundleTemplateSource) List(prefix string) ([]string, error) {
+	var keys []string
+
+	for key := range s.files {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// MemTemplateSource serves templates from memory, indexed by key.
+// It's used by template fixtures.
+type MemTemplateSource struct {
+	Templates map[string]string
+}
+
+func NewMemTemplateSource(templates map[string]string) *MemTemplateSource {
+	return &MemTemplateSource{
+		Templates: templates,
+	}
+}
+
+func (s *MemTemplateSource) Fetch(key, versionID string) (*FetchedTemplate, error) {
+	if versionID != "" {
+		return nil, fmt.Errorf("cannot fetch version '%s' of '%s', in-memory templates are not versioned", versionID, key)
+	}
+
+	if data, ok := s.Templates[key]; ok {
+		return newFetchedTemplate(key, data), nil
+	}
+
+	return nil, nil
+}
+
+func (s *MemTemplateSource) List(prefix string) ([]string, error) {
+	var keys []string
+
+	for key := range s.Templates {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// cleanTemplateKey normalizes template key and makes sure,
+// that it does not point outside of template source root.
+func cleanTemplateKey(key string) (string, error) {
+	name := path.Clean(key)
+
+	if name == "." || name == ".." || path.IsAbs(name) || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid template key '%s'", key)
+	}
+
+	return name, nil
+}
+
+var keyFormatPlaceholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// keyFormatPlaceholders lists named placeholders supported in key formats.
+var keyFormatPlaceholders = map[string]func(containerID, key string, account *Account) string{
+	"container":     func(containerID, key string, account *Account) string { return containerID },
+	"key":           func(containerID, key string, account *Account) string { return key },
+	"account":       func(containerID, key string, account *Account) string { return account.Name },
+	"account_short": func(containerID, key string, account *Account) string { return account.ShortName },
+	"account_id":    func(containerID, key string, account *Account) string { return account.ID },
+}
+
+// ValidateKeyFormat checks, that key format is either positional
+// fmt format with container ID and template key, or it contains
+// only known named placeholders, including {key}.
+func ValidateKeyFormat(format string) error {
+	matches := keyFormatPlaceholderRegexp.FindAllStringSubmatch(format, -1)
+
+	if len(matches) == 0 {
+		verbs := 0
+
+		for i := 0; i < len(format); i++ {
+			if format[i] != '%' {
+				continue
+			}
+
+			i++
+
+			switch {
+			case i < len(format) && format[i] == '%':
+			case i < len(format) && format[i] == 's':
+				verbs++
+			default:
+				return fmt.Errorf("key format '%s' must contain only '%%s' verbs", format)
+			}
+		}
+
+		if verbs != 2 {
+			return fmt.Errorf("key format '%s' must contain either named placeholders or exactly two '%%s'", format)
+		}
+		return nil
+	}
+
+	var hasKey bool
+
+	for _, m := range matches {
+		if _, ok := keyFormatPlaceholders[m[1]]; !ok {
+			return fmt.Errorf("unknown placeholder '%s' in key format '%s'", m[0], format)
+		}
+
+		hasKey = hasKey || m[1] == "key"
+	}
+
+	if !hasKey {
+		return fmt.Errorf("key format '%s' must contain {key} placeholder", format)
+	}
+
+	return nil
+}
+
+// FormatTemplateKey resolves key of template in template source.
+// Formats without named placeholders are treated as fmt format
+// with container ID and template key as arguments. False is returned,
+// if named placeholder resolves to empty string, like {account_short}
+// of account without short name, such format doesn't apply to account.
+func FormatTemplateKey(format, containerID, key string, account *Account) (string, bool) {
+	if !keyFormatPlaceholderRegexp.MatchString(format) {
+		return fmt.Sprintf(format, containerID, key), true
+	}
+
+	ok := true
+
+	res := keyFormatPlaceholderRegexp.ReplaceAllStringFunc(format, func(m string) string {
+		if f, found := keyFormatPlaceholders[m[1:len(m)-1]]; found {
+			v := f(containerID, key, account)
+			ok = ok && v != ""
+			return v
+		}
+		return m
+	})
+
+	return res, ok
+}
+
+// keyFormatMatcher returns listing prefix and regular expression, matching
+// keys of templates of given container. Template key is captured by
+// the first group of expression. For invalid format nil is returned.
+func keyFormatMatcher(format, containerID string) (string, *regexp.Regexp) {
+	var (
+		expr    bytes.Buffer
+		prefix  string
+		dynamic bool
+	)
+
+	literal := func(s string) {
+		if !dynamic {
+			prefix += s
+		}
+		expr.WriteString(regexp.QuoteMeta(s))
+	}
+
+	if !keyFormatPlaceholderRegexp.MatchString(format) {
+		parts := strings.SplitN(format, "%s", 3)
+
+		if len(parts) != 3 {
+			return "", nil
+		}
+
+		literal(parts[0])
+		literal(containerID)
+		literal(parts[1])
+		dynamic = true
+		expr.WriteString(`([^/]+)`)
+		literal(parts[2])
+	} else {
+		last := 0
+
+		for _, m := range keyFormatPlaceholderRegexp.FindAllStringSubmatchIndex(format, -1) {
+			literal(format[last:m[0]])
+			last = m[1]
+
+			switch format[m[2]:m[3]] {
+			case "container":
+				literal(containerID)
+			case "key":
+				dynamic = true
+				expr.WriteString(`([^/]+)`)
+			default:
+				dynamic = true
+				expr.WriteString(`(?:[^/]+)`)
+			}
+		}
+
+		literal(format[last:])
+	}
+
+	return prefix, regexp.MustCompile("^" + expr.String() + "$")
+}
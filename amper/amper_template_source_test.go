@@ -0,0 +1,590 @@
+package amper
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTemplateSourcePolicy = `{
+  "Statement": [{
+    "Effect": "Allow",
+    "Action": "s3:*",
+    "Resource": "arn:aws:s3:::{{ .container.ID }}-{{ .account.ShortName }}/*"
+  }]
+}`
+
+// testVersionedSource is versioned in-memory template source,
+// versions of keys are stored oldest first. Version IDs are unique
+// across keys, like in S3.
+type testVersionedSource struct {
+	versions map[string][]*FetchedTemplate
+	count    int
+}
+
+func newTestVersionedSource() *testVersionedSource {
+	return &testVersionedSource{
+		versions: make(map[string][]*FetchedTemplate),
+	}
+}
+
+// put stores new version of key and returns its version ID.
+func (s *testVersionedSource) put(key, content string) string {
+	t := newFetchedTemplate(key, content)
+	s.count++
+	t.VersionID = fmt.Sprintf("v%d", s.count)
+
+	s.versions[key] = append(s.versions[key], t)
+
+	return t.VersionID
+}
+
+func (s *testVersionedSource) Fetch(key, versionID string) (*FetchedTemplate, error) {
+	versions := s.versions[key]
+
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	if versionID == "" {
+		t := *versions[len(versions)-1]
+		return &t, nil
+	}
+
+	for _, v := range versions {
+		if v.VersionID == versionID {
+			t := *v
+			return &t, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *testVersionedSource) List(prefix string) ([]string, error) {
+	var keys []string
+
+	for key := range s.versions {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func writeTestTar(t *testing.T, file string, files map[string]string) {
+	f, err := os.Create(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for name, content := range files {
+		if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, file string, files map[string]string) {
+	f, err := os.Create(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testTemplateSourceRender(t *testing.T, source TemplateSource) {
+	amper, err := NewKernel(&AmperConfig{
+		TemplateSource: source,
+		KeyFormat:      "policies/%s/%s.json.tpl",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"s3", "missing"} {
+		if err = root.AddPolicyTemplate(&PolicyTemplate{Key: key, Scope: []string{"s3:*"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"s3", "missing"} {
+		if _, err = c1.AddAttachment(key, "sub-account-1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err, missing := c1.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(missing) != 1 || missing[0].String() != "missing" {
+		t.Fatalf("expected 'missing' template to be reported, got %v", missing)
+	}
+
+	if len(policy.Provenance) != 1 {
+		t.Fatalf("expected provenance of single template, got %d", len(policy.Provenance))
+	}
+
+	sum := sha256.Sum256([]byte(testTemplateSourcePolicy))
+
+	if p := policy.Provenance[0]; p.Key != "policies/root/s3.json.tpl" || p.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected provenance %+v", p)
+	}
+
+	statements := policy.AccountPolicies["sub-account-1"][0].Statements
+
+	if len(statements) == 0 || statements[0].Resources[0] != "arn:aws:s3:::c1-sa1/*" {
+		t.Fatalf("unexpected policy statements %v", statements)
+	}
+}
+
+func TestDirTemplateSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "policies", "root"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "policies", "root", "s3.json.tpl"), []byte(testTemplateSourcePolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := NewDirTemplateSource(dir)
+
+	if _, err = source.Fetch("../outside.json.tpl", ""); err == nil {
+		t.Fatal("expected error for key outside of template directory")
+	}
+
+	if _, err = source.Fetch("policies/root/s3.json.tpl", "v1"); err == nil {
+		t.Fatal("expected error for pinned version in template directory")
+	}
+
+	testTemplateSourceRender(t, source)
+}
+
+func TestBundleTemplateSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"./policies/root/s3.json.tpl": testTemplateSourcePolicy,
+	}
+
+	writeTestTar(t, filepath.Join(dir, "policies.tar.gz"), files)
+	writeTestZip(t, filepath.Join(dir, "policies.zip"), files)
+
+	for _, name := range []string{"policies.tar.gz", "policies.zip"} {
+		source, err := NewBundleTemplateSource(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testTemplateSourceRender(t, source)
+	}
+}
+
+func TestKeyFormatAccountVariant(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"policies/root/s3.json.tpl":     testTemplateSourcePolicy,
+		"policies/root/sa2/s3.json.tpl": `{"Statement": [{"Effect": "Allow", "Action": "s3:Get*", "Resource": "*"}]}`,
+	}
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []string{"policies/{container}/{account_short}/{key}.json.tpl", "policies/%s/%s.json.tpl"} {
+		if err = ValidateKeyFormat(format); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []string{"policies/{container}.json.tpl", "policies/{unknown}/{key}", "policies/%s.json", "policies/%d%s%s", "policies/%s/%s%v", "policies/%s/%s%"} {
+		if err = ValidateKeyFormat(format); err == nil {
+			t.Fatalf("expected key format '%s' to be invalid", format)
+		}
+	}
+
+	amper, err := NewKernel(&AmperConfig{
+		TemplateSource: NewDirTemplateSource(dir),
+		KeyFormats: []string{
+			"policies/{container}/{account_short}/{key}.json.tpl",
+			"policies/%s/%s.json.tpl",
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acc := range []*Account{
+		{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"},
+		{ID: "0123123", Name: "sub-account-2", ShortName: "sa2"},
+		{ID: "0323123", Name: "sub-account-3"},
+	} {
+		if err = amper.AddAccount(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = root.AddPolicyTemplate(&PolicyTemplate{Key: "s3", Scope: []string{"s3:*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, account := range []string{"sub-account-1", "sub-account-2", "sub-account-3"} {
+		if _, err = c1.AddAttachment("s3", account, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err, _ := c1.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := policy.AccountPolicies["sub-account-1"][0].Statements[0]; s.Resources[0] != "arn:aws:s3:::c1-sa1/*" {
+		t.Fatalf("expected default template for sub-account-1, got %v", s)
+	}
+
+	if s := policy.AccountPolicies["sub-account-2"][0].Statements[0]; s.Actions[0] != "s3:Get*" {
+		t.Fatalf("expected account variant for sub-account-2, got %v", s)
+	}
+
+	// Formats with empty placeholders are skipped.
+	if key, ok := FormatTemplateKey("policies/{container}/{account_short}/{key}.json.tpl", "root", "s3", &Account{Name: "sub-account-3"}); ok {
+		t.Fatalf("expected format to be skipped for account without short name, got '%s'", key)
+	}
+
+	if s := policy.AccountPolicies["sub-account-3"][0].Statements[0]; s.Resources[0] != "arn:aws:s3:::c1-/*" {
+		t.Fatalf("expected default template for sub-account-3, got %v", s)
+	}
+}
+
+func TestDiscoverPolicyTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"output/root/policies/s3.json.tpl",
+		"output/root/policies/s3.json.tpl.sig",
+		"output/root/policies/sa2/sqs.json.tpl",
+		"output/root/policies/sa2/s3.json.tpl",
+		"output/other/policies/iam.json.tpl",
+	}
+
+	for _, name := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(file, []byte(testTemplateSourcePolicy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	amper, err := NewKernel(&AmperConfig{
+		TemplateSource: NewDirTemplateSource(dir),
+		KeyFormats: []string{
+			"output/{container}/policies/{account_short}/{key}.json.tpl",
+			"output/%s/policies/%s.json.tpl",
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = root.AddPolicyTemplate(&PolicyTemplate{Key: "s3", Scope: []string{"s3:*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := amper.DiscoverPolicyTemplates("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(keys, ",") != "s3,sqs" {
+		t.Fatalf("unexpected discovered templates %v", keys)
+	}
+
+	if _, ok := amper.policyTemplates["sqs"]; !ok {
+		t.Fatal("expected discovered template to be registered")
+	}
+
+	// Other container has template with the same key.
+	otherS3 := `{"Statement": [{"Sid": "Other", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "output", "other", "policies", "s3.json.tpl"), []byte(otherS3), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := amper.NewContainer("other")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err = amper.DiscoverPolicyTemplates("other")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(keys, ",") != "iam,other/s3" {
+		t.Fatalf("unexpected discovered templates of other container %v", keys)
+	}
+
+	// Discovery is repeatable.
+	if keys, err = amper.DiscoverPolicyTemplates("other"); err != nil || strings.Join(keys, ",") != "iam,other/s3" {
+		t.Fatalf("unexpected result of repeated discovery %v, %v", keys, err)
+	}
+
+	if err = amper.AddAccount(&Account{ID: "111111111111", Name: "sub-account-2", ShortName: "sa2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = other.AddAttachment("other/s3", "sub-account-2", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := other.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := policy.AccountPolicies["sub-account-2"][0].Statements[0]; s.Sid != "Other" {
+		t.Fatalf("expected template of other container, got %+v", s)
+	}
+
+	if amper.policyTemplates["s3"].container != root {
+		t.Fatal("expected key to refer to template of root container")
+	}
+
+	if _, err = amper.DiscoverPolicyTemplates("unknown"); err == nil {
+		t.Fatal("expected error for unknown container")
+	}
+}
+
+func TestKernelKeyFormats(t *testing.T) {
+	if _, err := NewKernel(&AmperConfig{KeyFormats: []string{"output/{container}/policy.json.tpl"}}); err == nil || !strings.Contains(err.Error(), "must contain {key}") {
+		t.Fatalf("expected key format error, got %v", err)
+	}
+
+	if _, err := NewKernel(&AmperConfig{KeyFormat: "output/%s.json.tpl"}); err == nil {
+		t.Fatal("expected key format error")
+	}
+
+	amper, err := NewKernel(&AmperConfig{TemplateSource: NewMemTemplateSource(map[string]string{"output/root/policy.json.tpl": "{}"})})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = amper.NewContainer("root"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Formats set after creation of kernel are not validated.
+	amper.KeyFormats = []string{"output/{container}/policy.json.tpl"}
+
+	if _, err = amper.DiscoverPolicyTemplates("root"); err == nil || !strings.Contains(err.Error(), "invalid key format") {
+		t.Fatalf("expected invalid key format error, got %v", err)
+	}
+}
+
+func TestTemplateVersions(t *testing.T) {
+	source := newTestVersionedSource()
+
+	v1 := source.put("c1/s3", `{"Statement": [{"Sid": "First", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`)
+	v2 := source.put("c1/s3", `{"Statement": [{"Sid": "Second", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`)
+	source.put("c1/s3", `{"Statement": [{"Sid": "Latest", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`)
+	source.put("c1/dev/s3", `{"Statement": [{"Sid": "Dev", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`)
+
+	for _, test := range []struct {
+		account           string
+		templateVersion   string
+		attachmentVersion string
+		expected          string
+		err               string
+	}{
+		{"prod", "", "", "Latest", ""},
+		{"prod", v1, "", "First", ""},
+		{"prod", "", v2, "Second", ""},
+		{"prod", v1, v2, "Second", ""},
+		{"prod", "v9", "", "", "version 'v9' of template 'c1/s3' not found"},
+		{"dev", "", "", "Dev", ""},
+		// Version is pinned for the first existing key only.
+		{"dev", v1, "", "", "version 'v1' of template 'c1/dev/s3' not found"},
+	} {
+		amper, err := NewKernel(&AmperConfig{
+			TemplateSource: source,
+			KeyFormats:     []string{"{container}/{account}/{key}", "{container}/{key}"},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = amper.AddAccount(&Account{ID: "111111111111", Name: test.account}); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := amper.NewContainer("c1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = c.AddPolicyTemplate(&PolicyTemplate{Key: "s3", Scope: []string{"s3:*"}, VersionID: test.templateVersion}); err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := c.AddAttachment("s3", test.account, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a.VersionID = test.attachmentVersion
+
+		policy, err, _ := c.Policy()
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error '%s', got %v", test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sid := policy.AccountPolicies[test.account][0].Statements[0].Sid; sid != test.expected {
+			t.Fatalf("unexpected statement of versions '%s' and '%s', expected '%s', got '%s'", test.templateVersion, test.attachmentVersion, test.expected, sid)
+		}
+	}
+}
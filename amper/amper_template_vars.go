@@ -0,0 +1,344 @@
+package amper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of template variables.
+const (
+	VarTypeString = "string"
+	VarTypeList   = "list"
+	VarTypeMap    = "map"
+	VarTypeNumber = "number"
+	VarTypeBool   = "bool"
+)
+
+// Variable describes variable of policy template.
+type Variable struct {
+	Name string `yaml:"-"`
+
+	// Type is one of VarType* constants, string by default.
+	// Values of other types can be passed as strings, lists and
+	// maps are decoded from JSON in that case.
+	Type string `yaml:"type"`
+
+	Description string `yaml:"description"`
+
+	// Default is used, when variable is not set in attachment.
+	Default interface{} `yaml:"default"`
+
+	// Optional variables without default are set to zero value
+	// of their type, if they are not set in attachment.
+	Optional bool `yaml:"optional"`
+
+	// Pattern and Enum validate string values, elements of list
+	// and values of map.
+	Pattern string   `yaml:"pattern"`
+	Enum    []string `yaml:"enum"`
+
+	// untyped is set for variables inferred from template,
+	// their values are passed to template as is.
+	untyped bool
+}
+
+func (v *Variable) typeName() string {
+	if v.Type == "" {
+		return VarTypeString
+	}
+	return v.Type
+}
+
+// zero returns zero value of variable's type.
+func (v *Variable) zero() interface{} {
+	switch v.typeName() {
+	case VarTypeList:
+		return []interface{}{}
+	case VarTypeMap:
+		return map[string]interface{}{}
+	case VarTypeNumber:
+		return float64(0)
+	case VarTypeBool:
+		return false
+	}
+	return ""
+}
+
+// check validates definition of variable.
+func (v *Variable) check() error {
+	switch v.typeName() {
+	case VarTypeString, VarTypeList, VarTypeMap, VarTypeNumber, VarTypeBool:
+	default:
+		return fmt.Errorf("unknown type '%s' of variable '%s'", v.Type, v.Name)
+	}
+
+	if v.Pattern != "" {
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern of variable '%s': %s", v.Name, err)
+		}
+	}
+
+	if v.Default != nil {
+		if _, err := v.value(v.Default); err != nil {
+			return fmt.Errorf("invalid default: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// coerce converts value to type of variable.
+func (v *Variable) coerce(value interface{}) (interface{}, error) {
+	value = normalizeYAML(value)
+
+	if v.untyped {
+		return value, nil
+	}
+
+	switch v.typeName() {
+	case VarTypeString:
+		switch value := value.(type) {
+		case string:
+			return value, nil
+		case int, float64, bool:
+			return fmt.Sprintf("%v", value), nil
+		}
+	case VarTypeNumber:
+		switch value := value.(type) {
+		case string:
+			return strconv.ParseFloat(value, 64)
+		case int:
+			return float64(value), nil
+		case float64:
+			return value, nil
+		}
+	case VarTypeBool:
+		switch value := value.(type) {
+		case string:
+			return strconv.ParseBool(value)
+		case bool:
+			return value, nil
+		}
+	case VarTypeList:
+		switch value := value.(type) {
+		case string:
+			var res []interface{}
+			err := json.Unmarshal([]byte(value), &res)
+			return res, err
+		case []interface{}:
+			return value, nil
+		case []string:
+			res := make([]interface{}, 0, len(value))
+			for _, e := range value {
+				res = append(res, e)
+			}
+			return res, nil
+		}
+	case VarTypeMap:
+		switch value := value.(type) {
+		case string:
+			var res map[string]interface{}
+			err := json.Unmarshal([]byte(value), &res)
+			return res, err
+		case map[string]interface{}:
+			return value, nil
+		case map[string]string:
+			res := make(map[string]interface{}, len(value))
+			for k, e := range value {
+				res[k] = e
+			}
+			return res, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot use %T as %s", value, v.typeName())
+}
+
+// value coerces and validates value of variable.
+func (v *Variable) value(raw interface{}) (interface{}, error) {
+	value, err := v.coerce(raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of variable '%s': %s", v.Name, err)
+	}
+
+	var values []interface{}
+
+	switch value := value.(type) {
+	case string:
+		values = []interface{}{value}
+	case []interface{}:
+		values = value
+	case map[string]interface{}:
+		for _, e := range value {
+			values = append(values, e)
+		}
+	}
+
+	for _, e := range values {
+		s := fmt.Sprintf("%v", e)
+
+		if v.Pattern != "" && !regexp.MustCompile(v.Pattern).MatchString(s) {
+			return nil, fmt.Errorf("value '%s' of variable '%s' does not match pattern '%s'", s, v.Name, v.Pattern)
+		}
+
+		if len(v.Enum) > 0 && !stringInList(s, v.Enum) {
+			return nil, fmt.Errorf("value '%s' of variable '%s' must be one of [%s]", s, v.Name, strings.Join(v.Enum, ", "))
+		}
+	}
+
+	return value, nil
+}
+
+func stringInList(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// templateVariables builds variable schema from list of required
+// variables, their defaults and explicitly defined variables.
+func templateVariables(vars []string, defaults map[string]string, variables []*Variable) (map[string]*Variable, error) {
+	res := make(map[string]*Variable, len(vars)+len(defaults)+len(variables))
+
+	for _, name := range vars {
+		res[name] = &Variable{Name: name}
+	}
+
+	for name, d := range defaults {
+		if res[name] == nil {
+			res[name] = &Variable{Name: name}
+		}
+		res[name].Default = d
+	}
+
+	for _, v := range variables {
+		if res[v.Name] == nil {
+			res[v.Name] = v
+			continue
+		}
+
+		merged, conflicts := mergeVariable(res[v.Name], v)
+
+		if len(conflicts) > 0 {
+			return nil, fmt.Errorf("%s", strings.Join(conflicts, "; "))
+		}
+
+		res[v.Name] = merged
+	}
+
+	for _, v := range res {
+		if err := v.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// mergeVariable merges two declarations of same variable.
+// Values set in both declarations must be equal.
+func mergeVariable(a, b *Variable) (*Variable, []string) {
+	var (
+		conflicts []string
+		res       = *a
+	)
+
+	conflict := func(field string) {
+		conflicts = append(conflicts, fmt.Sprintf("%s of variable '%s' is declared differently", field, a.Name))
+	}
+
+	if b.Type != "" {
+		if a.Type != "" && a.Type != b.Type {
+			conflict("type")
+		}
+		res.Type = b.Type
+	}
+
+	if b.Description != "" {
+		if a.Description != "" && a.Description != b.Description {
+			conflict("description")
+		}
+		res.Description = b.Description
+	}
+
+	if b.Default != nil {
+		if a.Default != nil && !reflect.DeepEqual(normalizeYAML(a.Default), normalizeYAML(b.Default)) {
+			conflict("default")
+		}
+		res.Default = b.Default
+	}
+
+	if b.Pattern != "" {
+		if a.Pattern != "" && a.Pattern != b.Pattern {
+			conflict("pattern")
+		}
+		res.Pattern = b.Pattern
+	}
+
+	if len(b.Enum) > 0 {
+		if len(a.Enum) > 0 && !reflect.DeepEqual(a.Enum, b.Enum) {
+			conflict("enum")
+		}
+		res.Enum = b.Enum
+	}
+
+	// Variable is required, if any of declarations requires it.
+	res.Optional = a.Optional && b.Optional
+
+	return &res, conflicts
+}
+
+// templateVarValues validates variables of attachment against schema.
+// Returned map contains coerced values of all declared variables,
+// including defaults, and all undeclared variables as is.
+func templateVarValues(variables map[string]*Variable, vars map[string]interface{}) (map[string]interface{}, error) {
+	res := make(map[string]interface{}, len(variables)+len(vars))
+
+	for k, v := range vars {
+		res[k] = v
+	}
+
+	names := make([]string, 0, len(variables))
+
+	for name := range variables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := variables[name]
+		raw, ok := vars[name]
+
+		if !ok {
+			switch {
+			case v.Default != nil:
+				raw = v.Default
+			case v.Optional:
+				res[name] = v.zero()
+				continue
+			default:
+				return nil, fmt.Errorf("variable '%s' is not set", name)
+			}
+		}
+
+		value, err := v.value(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res[name] = value
+	}
+
+	return res, nil
+}
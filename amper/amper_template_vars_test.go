@@ -0,0 +1,94 @@
+package amper
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestTypedVariables(t *testing.T) {
+	amper, err := NewKernel(&AmperConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = root.AddPolicyTemplate(&PolicyTemplate{
+		Key:   "s3",
+		Scope: []string{"s3:*"},
+		Variables: []*Variable{
+			{Name: "buckets", Type: VarTypeList, Pattern: "^[a-z0-9-]+$"},
+			{Name: "write", Type: VarTypeBool, Default: "false"},
+			{Name: "prefix", Optional: true},
+			{Name: "tier", Enum: []string{"dev", "prod"}, Default: "dev"},
+		},
+		Template: aws.String(`{
+  "Statement": [{
+    "Sid": "{{ .vars.tier }}",
+    "Effect": "Allow",
+    "Action": [{{ if .vars.write }}"s3:PutObject", {{ end }}"s3:GetObject"],
+    "Resource": [{{ range $i, $b := .vars.buckets }}{{ if $i }}, {{ end }}"arn:aws:s3:::{{ $b }}/{{ $.vars.prefix }}*"{{ end }}]
+  }]
+}`),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = root.AddPolicyTemplate(&PolicyTemplate{
+		Key:       "invalid",
+		Variables: []*Variable{{Name: "count", Type: "integer"}},
+		Template:  aws.String(`{"Statement": []}`),
+	})
+
+	if err == nil {
+		t.Fatal("expected error for unknown variable type")
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []map[string]interface{}{
+		{},
+		{"buckets": "not a list"},
+		{"buckets": []interface{}{"Invalid_Bucket"}},
+		{"buckets": `["b1"]`, "tier": "staging"},
+		{"buckets": `["b1"]`, "write": "maybe"},
+	}
+
+	for _, vars := range invalid {
+		if _, err = c1.AddAttachment("s3", "sub-account-1", vars); err == nil {
+			t.Fatalf("expected error for vars %v", vars)
+		}
+	}
+
+	if _, err = c1.AddAttachment("s3", "sub-account-1", map[string]interface{}{"buckets": `["b1", "b2"]`, "write": "true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err, _ := c1.Policy()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := policy.AccountPolicies["sub-account-1"][0].Statements[0]
+
+	if s.Sid != "dev" || len(s.Actions) != 2 || len(s.Resources) != 2 || s.Resources[1] != "arn:aws:s3:::b2/*" {
+		t.Fatalf("unexpected statement %+v", s)
+	}
+}
@@ -0,0 +1,107 @@
+package amper
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// TemplateSignatureSuffix is appended to template key for locating
+// detached OpenPGP signature of template in template source.
+const TemplateSignatureSuffix = ".sig"
+
+// SignedTemplatePayload returns data, which is covered by detached
+// signature of template. It binds content to the key and container
+// of template, so signed template can't be copied to other key or
+// container. Version ID of versioned template is signed as well, so
+// restored older version, which gets new version ID, isn't covered by
+// signature of the version it was copied from. Such templates are
+// signed after upload. Unversioned sources can't detect rollback, pin
+// SHA256 of template instead.
+func SignedTemplatePayload(key, container, versionID, content string) string {
+	if isUnversioned(versionID) {
+		return fmt.Sprintf("amper-template\nkey: %s\ncontainer: %s\n\n%s", key, container, content)
+	}
+
+	return fmt.Sprintf("amper-template\nkey: %s\ncontainer: %s\nversion: %s\n\n%s", key, container, versionID, content)
+}
+
+// TemplateSignatureKey returns key of signature of template. Signature
+// of versioned template is stored per version, as <key>@<version>.sig.
+func TemplateSignatureKey(key, versionID string) string {
+	if isUnversioned(versionID) {
+		return key + TemplateSignatureSuffix
+	}
+
+	return key + "@" + versionID + TemplateSignatureSuffix
+}
+
+// isUnversioned returns true for version ID of unversioned object,
+// S3 reports "null" for objects uploaded before versioning is enabled.
+func isUnversioned(versionID string) bool {
+	return versionID == "" || versionID == "null"
+}
+
+// ReadKeyring parses ASCII armored OpenPGP public keyring.
+func ReadKeyring(armored string) (openpgp.EntityList, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed reading keyring: %s", err)
+	}
+
+	return keyring, nil
+}
+
+// verifyTemplate checks integrity of fetched template.
+// If SHA256 is set, template content must match it.
+// If signature is required, template must have valid detached signature
+// of SignedTemplatePayload, made by one of the keys from Kernel's keyring,
+// see TemplateSignatureKey.
+func (pt *PolicyTemplate) verifyTemplate(t *FetchedTemplate) error {
+	if pt.SHA256 != "" && !strings.EqualFold(pt.SHA256, t.SHA256) {
+		return fmt.Errorf("checksum mismatch of template '%s', expected %s, got %s", t.Key, pt.SHA256, t.SHA256)
+	}
+
+	if !pt.RequireSignature && !pt.amper.RequireSignature {
+		return nil
+	}
+
+	if pt.amper.Keyring == nil {
+		return fmt.Errorf("cannot verify signature of template '%s', keyring is not configured", t.Key)
+	}
+
+	sigKey := TemplateSignatureKey(t.Key, t.VersionID)
+
+	sig, err := pt.amper.TemplateSource.Fetch(sigKey, "")
+
+	if err != nil {
+		return err
+	}
+
+	if sig == nil {
+		return fmt.Errorf("signature '%s' of template '%s' not found", sigKey, t.Key)
+	}
+
+	var (
+		signed    = strings.NewReader(SignedTemplatePayload(t.Key, pt.container.ID, t.VersionID, t.Content))
+		signature = strings.NewReader(sig.Content)
+		signer    *openpgp.Entity
+	)
+
+	if bytes.HasPrefix(bytes.TrimSpace([]byte(sig.Content)), []byte("-----BEGIN")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(pt.amper.Keyring, signed, signature)
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(pt.amper.Keyring, signed, signature)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid signature of template '%s': %s", t.Key, err)
+	}
+
+	t.SignedBy = fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+
+	return nil
+}
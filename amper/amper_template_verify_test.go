@@ -0,0 +1,203 @@
+package amper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func testVerifyKernel(t *testing.T, dir string, keyring openpgp.KeyRing, pt *PolicyTemplate) error {
+	return testVerifySource(t, NewDirTemplateSource(dir), keyring, pt, "")
+}
+
+func testVerifySource(t *testing.T, source TemplateSource, keyring openpgp.KeyRing, pt *PolicyTemplate, versionID string) error {
+	amper, err := NewKernel(&AmperConfig{
+		TemplateSource: source,
+		KeyFormat:      "policies/%s/%s.json.tpl",
+		Keyring:        keyring,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amper.AddAccount(&Account{ID: "023123123", Name: "sub-account-1", ShortName: "sa1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := amper.NewContainer("root")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = root.AddPolicyTemplate(pt); err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := amper.NewContainer("c1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := c1.AddAttachment(pt.Key, "sub-account-1", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.VersionID = versionID
+
+	_, err, _ = c1.Policy()
+
+	return err
+}
+
+func TestVerifyTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "policies", "root"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "policies", "root", "s3.json.tpl")
+
+	if err = ioutil.WriteFile(file, []byte(testTemplateSourcePolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(testTemplateSourcePolicy))
+
+	if err = testVerifyKernel(t, dir, nil, &PolicyTemplate{Key: "s3", SHA256: hex.EncodeToString(sum[:])}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = testVerifyKernel(t, dir, nil, &PolicyTemplate{Key: "s3", SHA256: strings.Repeat("0", 64)}); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+
+	signer, err := openpgp.NewEntity("amper", "test", "amper@example.com", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := openpgp.NewEntity("other", "test", "other@example.com", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = testVerifyKernel(t, dir, openpgp.EntityList{signer}, &PolicyTemplate{Key: "s3", RequireSignature: true}); err == nil {
+		t.Fatal("expected missing signature error")
+	}
+
+	var sig bytes.Buffer
+
+	payload := SignedTemplatePayload("policies/root/s3.json.tpl", "root", "", testTemplateSourcePolicy)
+
+	if err = openpgp.ArmoredDetachSign(&sig, signer, strings.NewReader(payload), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(file+TemplateSignatureSuffix, sig.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = testVerifyKernel(t, dir, openpgp.EntityList{signer}, &PolicyTemplate{Key: "s3", RequireSignature: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = testVerifyKernel(t, dir, openpgp.EntityList{other}, &PolicyTemplate{Key: "s3", RequireSignature: true}); err == nil {
+		t.Fatal("expected signature verification error for unknown signer")
+	}
+
+	// Signed template copied to other key doesn't verify.
+	copied := filepath.Join(dir, "policies", "root", "s3copy.json.tpl")
+
+	for src, dst := range map[string]string{file: copied, file + TemplateSignatureSuffix: copied + TemplateSignatureSuffix} {
+		data, err := ioutil.ReadFile(src)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(dst, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = testVerifyKernel(t, dir, openpgp.EntityList{signer}, &PolicyTemplate{Key: "s3copy", RequireSignature: true}); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Fatalf("expected signature verification error for copied template, got %v", err)
+	}
+}
+
+func TestVerifyVersionedTemplate(t *testing.T) {
+	signer, err := openpgp.NewEntity("amper", "test", "amper@example.com", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "policies/root/s3.json.tpl"
+
+	source := newTestVersionedSource()
+
+	sign := func(version, content string) {
+		var sig bytes.Buffer
+
+		if err := openpgp.ArmoredDetachSign(&sig, signer, strings.NewReader(SignedTemplatePayload(key, "root", version, content)), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		source.put(TemplateSignatureKey(key, version), sig.String())
+	}
+
+	v1 := source.put(key, testTemplateSourcePolicy)
+	sign(v1, testTemplateSourcePolicy)
+
+	v2Policy := strings.Replace(testTemplateSourcePolicy, "s3:*", "s3:GetObject", 1)
+	v2 := source.put(key, v2Policy)
+	sign(v2, v2Policy)
+
+	keyring := openpgp.EntityList{signer}
+
+	// Pinned older version is checked against signature of that version.
+	if err = testVerifySource(t, source, keyring, &PolicyTemplate{Key: "s3", RequireSignature: true}, v1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = testVerifySource(t, source, keyring, &PolicyTemplate{Key: "s3", RequireSignature: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restored older version gets new version ID, which is not signed.
+	source.put(key, testTemplateSourcePolicy)
+
+	if err = testVerifySource(t, source, keyring, &PolicyTemplate{Key: "s3", RequireSignature: true}, ""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing signature error for restored version, got %v", err)
+	}
+
+	// Signature copied onto restored version doesn't cover its version ID.
+	v4 := source.put(key, testTemplateSourcePolicy)
+	sig, _ := source.Fetch(TemplateSignatureKey(key, v1), "")
+	source.put(TemplateSignatureKey(key, v4), sig.Content)
+
+	if err = testVerifySource(t, source, keyring, &PolicyTemplate{Key: "s3", RequireSignature: true}, ""); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Fatalf("expected invalid signature error for restored version, got %v", err)
+	}
+}
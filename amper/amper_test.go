@@ -40,12 +40,16 @@ func TestStaticPolicy(t *testing.T) {
 		acc1, acc2 *Account
 	)
 
-	amper = NewKernel(&AmperConfig{
+	amper, err = NewKernel(&AmperConfig{
 		S3:          getS3(t),
 		StateBucket: "vahe-test-bucket-sandbox",
 		KeyFormat:   "policies/%s/%s.json.tpl",
 	})
 
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	acc1 = &Account{
 		ID:        "023123123",
 		Name:      "sub-account-1",
@@ -139,12 +143,16 @@ func TestS3PolicyTemplate(t *testing.T) {
 		err      error
 		IAM, SQS *PolicyTemplate
 	)
-	amper = NewKernel(&AmperConfig{
+	amper, err = NewKernel(&AmperConfig{
 		S3:          getS3(t),
 		StateBucket: "vahe-test-bucket-sandbox",
 		KeyFormat:   "policies/%s/%s.json.tpl",
 	})
 
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	acc = &Account{
 		ID:        "023123123",
 		Name:      "sub-account-1",
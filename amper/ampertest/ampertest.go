@@ -0,0 +1,159 @@
+// Package ampertest renders policy templates from fixtures and compares
+// them against golden files, without Terraform and AWS.
+//
+// Fixture is a directory with fixture.yaml file, which contains amper.Config
+// with accounts, containers, attachments and templates. Templates without
+// inline content are served from in-memory template source, see
+// amper.Config.Templates. Rendered policies of each account are compared
+// against golden/<account>.json, which is JSON object of container policies
+// indexed by container ID. Run tests with -update flag to write golden files.
+package ampertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+// FixtureFile is the name of fixture config in fixture directory.
+const FixtureFile = "fixture.yaml"
+
+// GoldenDir is the name of directory with golden files in fixture directory.
+const GoldenDir = "golden"
+
+// Update makes fixtures write golden files, instead of comparing.
+var Update = flag.Bool("update", false, "update golden files of amper fixtures")
+
+// Render loads fixture from directory and renders policies of all
+// accounts as indented JSON, indexed by account name.
+func Render(dir string) (map[string][]byte, error) {
+	cfg, err := amper.LoadConfig(filepath.Join(dir, FixtureFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := cfg.NewKernel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, _, err := k.RenderAccounts()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]byte, len(accounts))
+
+	for account, policies := range accounts {
+		data, err := json.MarshalIndent(policies, "", "  ")
+
+		if err != nil {
+			return nil, err
+		}
+
+		res[account] = append(data, '\n')
+	}
+
+	return res, nil
+}
+
+// RunFixture renders fixture in directory and compares result with
+// golden files. With -update flag golden files are written instead.
+func RunFixture(t *testing.T, dir string) {
+	t.Helper()
+
+	rendered, err := Render(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goldenDir := filepath.Join(dir, GoldenDir)
+
+	if *Update {
+		if err = os.RemoveAll(goldenDir); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		for account, data := range rendered {
+			if err = ioutil.WriteFile(filepath.Join(goldenDir, account+".json"), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(goldenDir, "*.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		account := strings.TrimSuffix(filepath.Base(file), ".json")
+		golden[account] = true
+
+		expected, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, ok := rendered[account]
+
+		if !ok {
+			t.Errorf("account '%s' has golden file, but no policies rendered", account)
+			continue
+		}
+
+		if !bytes.Equal(expected, data) {
+			t.Errorf("policies of account '%s' differ from golden file '%s', expected:\n%s\ngot:\n%s", account, file, expected, data)
+		}
+	}
+
+	for account := range rendered {
+		if !golden[account] {
+			t.Errorf("golden file of account '%s' is missing, run with -update flag", account)
+		}
+	}
+}
+
+// RunFixtures runs all fixtures in subdirectories of dir as subtests.
+func RunFixtures(t *testing.T, dir string) {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*", FixtureFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatalf("no fixtures found in '%s'", dir)
+	}
+
+	for _, file := range files {
+		fixture := filepath.Dir(file)
+
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			RunFixture(t, fixture)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package ampertest
+
+import (
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	RunFixtures(t, "testdata")
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/spirius/terraform-provider-amper/amper"
 )
 
@@ -27,6 +28,55 @@ func dataSourceAmperAccount() *schema.Resource {
 				ForceNew:     true,
 				ValidateFunc: validateName,
 			},
+			"managed_policy_size": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Maximum size of managed policy, overrides default limit",
+			},
+			"managed_policies_per_role": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Maximum number of managed policies per role, overrides default limit",
+			},
+			"tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				ForceNew: true,
+				Elem:     schema.TypeString,
+			},
+			"environment": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Environment tier of account, like prod or sandbox",
+			},
+			"partition": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      amper.DefaultPartition,
+				ValidateFunc: validation.StringInSlice(amper.Partitions, false),
+			},
+			"regions": {
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"email": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"groups": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
 		},
 	}
 }
@@ -38,6 +88,28 @@ func dataSourceAmperAccountRead(d *schema.ResourceData, meta interface{}) error
 		ID:        d.Get("account_id").(string),
 		Name:      d.Get("name").(string),
 		ShortName: d.Get("short_name").(string),
+
+		Limits: amper.AccountLimits{
+			ManagedPolicySize:      d.Get("managed_policy_size").(int),
+			ManagedPoliciesPerRole: d.Get("managed_policies_per_role").(int),
+		},
+
+		Environment: d.Get("environment").(string),
+		Partition:   d.Get("partition").(string),
+		Regions:     resourceGetStringListFromList(d.Get("regions").([]interface{})),
+		Email:       d.Get("email").(string),
+	}
+
+	if attr, ok := d.GetOk("tags"); ok {
+		account.Tags = make(map[string]string)
+
+		for k, v := range attr.(map[string]interface{}) {
+			account.Tags[k] = v.(string)
+		}
+	}
+
+	for _, g := range d.Get("groups").(*schema.Set).List() {
+		account.Groups = append(account.Groups, g.(string))
 	}
 
 	d.SetId(d.Get("account_id").(string))
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+func dataSourceAmperAccountGroup() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAmperAccountGroupRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateName,
+			},
+			"accounts": {
+				Type:        schema.TypeList,
+				Required:    true,
+				ForceNew:    true,
+				Description: "Names or glob patterns of account names, patterns match only accounts read before group",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"members": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "Names of accounts of group, resolved when group is read",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func dataSourceAmperAccountGroupRead(d *schema.ResourceData, meta interface{}) error {
+	cc := meta.(*amper.Kernel)
+
+	g := &amper.AccountGroup{
+		Name:     d.Get("name").(string),
+		Accounts: resourceGetStringListFromList(d.Get("accounts").([]interface{})),
+	}
+
+	if err := cc.AddAccountGroup(g); err != nil {
+		return err
+	}
+
+	d.SetId(g.Name)
+	d.Set("members", g.Members())
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+const testAccountGroupConfig = `
+data "amper_account" "eu" {
+  account_id = "555555555555"
+  name       = "group-prod-eu"
+  short_name = "eu"
+}
+
+data "amper_account" "us" {
+  account_id = "666666666666"
+  name       = "group-prod-us"
+  short_name = "us"
+}
+
+data "amper_account_group" "prod" {
+  name     = "group-prod"
+  accounts = ["${data.amper_account.eu.name}", "${data.amper_account.us.name}"]
+}
+
+data "amper_policy_template" "test" {
+  key   = "group"
+  scope = ["s3:*"]
+
+  template = <<EOF
+{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}
+EOF
+}
+
+data "amper_container" "test" {
+  name = "group"
+
+  attachment {
+    policy_template_id = "${data.amper_policy_template.test.id}"
+    account_group      = "${data.amper_account_group.prod.name}"
+  }
+}
+`
+
+const testAccountGroupPatternConfig = `
+data "amper_container" "test" {
+  name = "group-pattern"
+
+  attachment {
+    policy_template_id = "group"
+    account_name       = "group-prod-*"
+  }
+}
+`
+
+func TestAccountGroup(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]terraform.ResourceProvider{
+			"amper": testProvider,
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testAccountGroupConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.amper_account_group.prod", "members.#", "2"),
+					resource.TestCheckResourceAttr("data.amper_account_group.prod", "members.0", "group-prod-eu"),
+					resource.TestCheckResourceAttr("data.amper_container.test", "policies.group-prod-eu_count", "1"),
+					resource.TestCheckResourceAttr("data.amper_container.test", "policies.group-prod-us_count", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccountGroupPattern(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]terraform.ResourceProvider{
+			"amper": testProvider,
+		},
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccountGroupPatternConfig,
+				ExpectError: regexp.MustCompile("account pattern 'group-prod-\\*' is not supported in attachment"),
+			},
+		},
+	})
+}
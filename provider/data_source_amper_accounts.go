@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+func dataSourceAmperAccounts() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAmperAccountsRead,
+
+		Schema: map[string]*schema.Schema{
+			"file": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "JSON output of `aws organizations list-accounts`, optionally with OU and Tags of accounts",
+			},
+			"name_format": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     amper.DefaultOrgNameFormat,
+				Description: "Template of account name",
+			},
+			"short_name_format": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Template of account short name, accounts have no short names by default",
+			},
+			"include_inactive": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+			"names": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func dataSourceAmperAccountsRead(d *schema.ResourceData, meta interface{}) error {
+	cc := meta.(*amper.Kernel)
+
+	file, err := homedir.Expand(d.Get("file").(string))
+
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	export, err := amper.ReadOrgExport(data)
+
+	if err != nil {
+		return err
+	}
+
+	imp := &amper.OrgImport{
+		NameFormat:      d.Get("name_format").(string),
+		ShortNameFormat: d.Get("short_name_format").(string),
+		IncludeInactive: d.Get("include_inactive").(bool),
+	}
+
+	accounts, err := imp.Accounts(export)
+
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(accounts))
+
+	for _, account := range accounts {
+		_, errs := validateName(account.Name, "name")
+
+		if account.ShortName != "" {
+			_, shortErrs := validateName(account.ShortName, "short_name")
+			errs = append(errs, shortErrs...)
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid account '%s': %s", account.ID, errs[0])
+		}
+
+		if err = cc.AddAccount(account); err != nil {
+			return err
+		}
+
+		names = append(names, account.Name)
+	}
+
+	d.Set("names", names)
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256(data)))
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+func dataSourceAmperConfig() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAmperConfigRead,
+
+		Schema: map[string]*schema.Schema{
+			"file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "YAML or JSON file with accounts, policy templates and containers",
+				ConflictsWith: []string{"content"},
+			},
+			"content": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "YAML or JSON content with accounts, policy templates and containers",
+				ConflictsWith: []string{"file"},
+			},
+			"accounts": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"containers": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"policies": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Policies of containers, indexed by <container>/<account>_<n>",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"role_policies": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"service_role_policies": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"applied_guardrails": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Comma-separated names of guardrail statements, indexed by <container>/<account>",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func dataSourceAmperConfigRead(d *schema.ResourceData, meta interface{}) error {
+	cc := meta.(*amper.Kernel)
+
+	var data []byte
+
+	if attr, ok := d.GetOk("file"); ok {
+		file, err := homedir.Expand(attr.(string))
+
+		if err != nil {
+			return err
+		}
+
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return err
+		}
+	} else if attr, ok := d.GetOk("content"); ok {
+		data = []byte(attr.(string))
+	} else {
+		return fmt.Errorf("one of 'file' or 'content' must be set")
+	}
+
+	cfg, err := amper.ParseConfig(data)
+
+	if err != nil {
+		return fmt.Errorf("invalid amper config: %s", err)
+	}
+
+	if len(cfg.Templates) > 0 {
+		return fmt.Errorf("templates are not supported in amper_config, use inline templates or template source of provider")
+	}
+
+	// Config is loaded into kernel of provider, so
+	// kernel settings must be configured in provider.
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"key_formats", len(cfg.KeyFormats) > 0},
+		{"role_name_format", cfg.RoleNameFormat != ""},
+		{"missing_key_error", cfg.MissingKeyError},
+		{"sandbox_funcs", cfg.SandboxFuncs},
+		{"guardrails", len(cfg.Guardrails) > 0},
+	} {
+		if setting.set {
+			return fmt.Errorf("%s is not supported in amper_config, configure it in provider", setting.name)
+		}
+	}
+
+	containers, err := cfg.Load(cc)
+
+	if err != nil {
+		return err
+	}
+
+	accounts := make([]string, 0, len(cfg.Accounts))
+
+	for _, a := range cfg.Accounts {
+		accounts = append(accounts, a.Name)
+	}
+
+	var (
+		ids            = make([]string, 0, len(containers))
+		policyMap      = map[string]string{}
+		rolePolicyMap  = map[string]string{}
+		serviceRoleMap = map[string]string{}
+		guardrailMap   = map[string]string{}
+	)
+
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+
+		p, err, missing := c.Policy()
+
+		if err != nil {
+			return err
+		}
+
+		for _, a := range missing {
+			log.Printf("[WARN] Policy template not found for '%s' in container '%s'", a, c.ID)
+		}
+
+		for _, w := range p.Warnings {
+			log.Printf("[WARN] Container '%s': %s", c.ID, w)
+		}
+
+		policies, rolePolicies, serviceRoles, err := policyMaps(p, c.ID+"/")
+
+		if err != nil {
+			return err
+		}
+
+		for _, m := range []struct{ dst, src map[string]string }{
+			{policyMap, policies},
+			{rolePolicyMap, rolePolicies},
+			{serviceRoleMap, serviceRoles},
+			{guardrailMap, guardrailNames(p, c.ID+"/")},
+		} {
+			for k, v := range m.src {
+				m.dst[k] = v
+			}
+		}
+	}
+
+	d.Set("accounts", accounts)
+	d.Set("containers", ids)
+	d.Set("policies", policyMap)
+	d.Set("role_policies", rolePolicyMap)
+	d.Set("service_role_policies", serviceRoleMap)
+	d.Set("applied_guardrails", guardrailMap)
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256(data)))
+
+	return nil
+}
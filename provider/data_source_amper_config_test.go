@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+const testConfigConfig = `
+data "amper_config" "test" {
+  content = <<EOF
+accounts:
+  - {id: "111111111111", name: config-prod}
+containers:
+  - id: config-c1
+    policy_templates:
+      - key: config-t1
+        scope: ["s3:*"]
+        template: '{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}'
+    attachments:
+      - {policy_template: config-t1, account: config-prod}
+EOF
+}
+`
+
+const testConfigKernelSettingsConfig = `
+data "amper_config" "test" {
+  content = <<EOF
+sandbox_funcs: true
+EOF
+}
+`
+
+func TestConfig(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]terraform.ResourceProvider{
+			"amper": testProvider,
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testConfigConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.amper_config.test", "containers.0", "config-c1"),
+					resource.TestCheckResourceAttr("data.amper_config.test", "policies.config-c1/config-prod_count", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestConfigKernelSettings(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]terraform.ResourceProvider{
+			"amper": testProvider,
+		},
+		Steps: []resource.TestStep{
+			{
+				Config:      testConfigKernelSettingsConfig,
+				ExpectError: regexp.MustCompile("sandbox_funcs is not supported in amper_config"),
+			},
+		},
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/spirius/terraform-provider-amper/amper"
@@ -20,6 +21,86 @@ func dataSourceAmperContainer() *schema.Resource {
 				ValidateFunc: validateContainerName,
 				ForceNew:     true,
 			},
+			"deny_other_regions": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Deny requests to regions, which are not allowed in account",
+			},
+			"abac": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				MaxItems:    1,
+				Description: "Scope Allow statements on taggable resources to resources tagged with container's tag",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"tag_key": {
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+						"tag_value": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "Value of the tag, defaults to container name",
+						},
+					},
+				},
+			},
+			"disable_deny_unknown": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Do not deny services, which are out of scope of policy templates",
+			},
+			"allow_list_only": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Do not add AllowAll statement, only actions allowed by policy templates are allowed",
+			},
+			"exclude_guardrails": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Names of guardrails of provider, which are not added to policies of container",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"condition": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Condition injected into Allow statements of container",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"test": {
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+						"variable": {
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+						"values": {
+							Type:     schema.TypeList,
+							Required: true,
+							ForceNew: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"services": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "Inject only into statements with actions of these services",
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
 			"attachment": {
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -27,15 +108,22 @@ func dataSourceAmperContainer() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"account_name": {
+							Type:        schema.TypeString,
+							ForceNew:    true,
+							Optional:    true,
+							Description: "Name, ID or short name of account, use account_group for glob patterns",
+						},
+						"account_group": {
 							Type:     schema.TypeString,
 							ForceNew: true,
-							Required: true,
+							Optional: true,
 						},
 						"policy_template_id": {
 							Type:         schema.TypeString,
 							Required:     true,
 							ForceNew:     true,
-							ValidateFunc: validateName,
+							Description:  "Key of policy template or <container>/<key>",
+							ValidateFunc: validatePolicyTemplateID,
 						},
 						"vars": {
 							Type:     schema.TypeMap,
@@ -43,6 +131,11 @@ func dataSourceAmperContainer() *schema.Resource {
 							ForceNew: true,
 							Elem:     schema.TypeString,
 						},
+						"version_id": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+						},
 					},
 				},
 			},
@@ -67,6 +160,51 @@ func dataSourceAmperContainer() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"applied_guardrails": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Comma-separated names of guardrail statements, indexed by account name",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"templates": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "Provenance of fetched templates",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"account_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"policy_template_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"key": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"version_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"etag": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"sha256": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"signed_by": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
 		},
 	}
 }
@@ -80,24 +218,59 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 		return err
 	}
 
+	c.DenyOtherRegions = d.Get("deny_other_regions").(bool)
+	c.DisableDenyUnknown = d.Get("disable_deny_unknown").(bool)
+	c.AllowListOnly = d.Get("allow_list_only").(bool)
+	c.ExcludeGuardrails = resourceGetStringListFromList(d.Get("exclude_guardrails").([]interface{}))
+
+	if l := d.Get("abac").([]interface{}); len(l) > 0 && l[0] != nil {
+		abac := l[0].(map[string]interface{})
+
+		c.ABAC = &amper.ABAC{
+			TagKey:   abac["tag_key"].(string),
+			TagValue: abac["tag_value"].(string),
+		}
+	}
+
+	for _, raw := range d.Get("condition").([]interface{}) {
+		l := raw.(map[string]interface{})
+
+		c.Conditions = append(c.Conditions, &amper.InjectedCondition{
+			Operator: l["test"].(string),
+			Key:      l["variable"].(string),
+			Values:   resourceGetStringListFromList(l["values"].([]interface{})),
+			Services: resourceGetStringListFromList(l["services"].([]interface{})),
+		})
+	}
+
 	attachments := d.Get("attachment").(*schema.Set).List()
 
 	for _, raw := range attachments {
 		l := raw.(map[string]interface{})
 
-		var vars = map[string]string{}
+		// Patterns would match only accounts, which are read before
+		// container, groups resolve them in dependency order.
+		if name := l["account_name"].(string); amper.IsAccountPattern(name) {
+			return fmt.Errorf("account pattern '%s' is not supported in attachment, use account_group", name)
+		}
+
+		var vars = map[string]interface{}{}
 
 		if attr, ok := l["vars"]; ok {
 			for k, v := range attr.(map[string]interface{}) {
-				vars[k] = v.(string)
+				vars[k] = v
 			}
 		}
 
-		_, err := c.AddAttachment(l["policy_template_id"].(string), l["account_name"].(string), vars)
+		attachments, err := c.AddAttachments(l["policy_template_id"].(string), l["account_name"].(string), l["account_group"].(string), vars)
 
 		if err != nil {
 			return err
 		}
+
+		for _, a := range attachments {
+			a.VersionID = l["version_id"].(string)
+		}
 	}
 
 	p, err, missing := c.Policy()
@@ -106,6 +279,52 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 		return err
 	}
 
+	for _, a := range missing {
+		log.Printf("[WARN] Policy template not found for '%s' in attachment '%s'", a, d.Id())
+	}
+
+	for _, w := range p.Warnings {
+		log.Printf("[WARN] Container '%s': %s", c.ID, w)
+	}
+
+	policyMap, rolePolicyMap, serviceRoleMap, err := policyMaps(p, "")
+
+	if err != nil {
+		return err
+	}
+
+	d.Set("policies", policyMap)
+	d.Set("role_policies", rolePolicyMap)
+	d.Set("service_role_policies", serviceRoleMap)
+	d.Set("applied_guardrails", guardrailNames(p, ""))
+
+	templates := make([]map[string]interface{}, 0, len(p.Provenance))
+
+	for _, t := range p.Provenance {
+		templates = append(templates, map[string]interface{}{
+			"account_name":       t.Account,
+			"policy_template_id": t.TemplateKey,
+			"key":                t.Key,
+			"version_id":         t.VersionID,
+			"etag":               t.ETag,
+			"sha256":             t.SHA256,
+			"signed_by":          t.SignedBy,
+		})
+	}
+
+	if err = d.Set("templates", templates); err != nil {
+		return err
+	}
+
+	d.SetId(d.Get("name").(string))
+
+	return nil
+}
+
+// policyMaps flattens rendered policies of container into maps of
+// policies, role policies and service role policies, indexed by
+// account name with given prefix.
+func policyMaps(p *amper.Policy, prefix string) (map[string]string, map[string]string, map[string]string, error) {
 	policyMap := map[string]string{}
 
 	for account, policies := range p.AccountPolicies {
@@ -113,13 +332,13 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 			s, err := json.MarshalIndent(policy, "", "  ")
 
 			if err != nil {
-				return err
+				return nil, nil, nil, err
 			}
 
-			policyMap[fmt.Sprintf("%s_%d", account, k)] = string(s)
+			policyMap[fmt.Sprintf("%s%s_%d", prefix, account, k)] = string(s)
 		}
 
-		policyMap[fmt.Sprintf("%s_count", account)] = fmt.Sprintf("%d", len(policies))
+		policyMap[fmt.Sprintf("%s%s_count", prefix, account)] = fmt.Sprintf("%d", len(policies))
 	}
 
 	rolePolicyMap := map[string]string{}
@@ -129,22 +348,15 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 			s, err := json.MarshalIndent(policy, "", "  ")
 
 			if err != nil {
-				return err
+				return nil, nil, nil, err
 			}
 
-			rolePolicyMap[fmt.Sprintf("%s_%d", account, k)] = string(s)
+			rolePolicyMap[fmt.Sprintf("%s%s_%d", prefix, account, k)] = string(s)
 		}
 
-		rolePolicyMap[fmt.Sprintf("%s_count", account)] = fmt.Sprintf("%d", len(policies))
+		rolePolicyMap[fmt.Sprintf("%s%s_count", prefix, account)] = fmt.Sprintf("%d", len(policies))
 	}
 
-	for _, a := range missing {
-		log.Printf("[WARN] Policy template not found for '%s' in attachment '%s'", a, d.Id())
-	}
-
-	d.Set("policies", policyMap)
-	d.Set("role_policies", rolePolicyMap)
-
 	serviceRoleMap := map[string]string{}
 
 	for account, serviceRoles := range p.ServiceRolePolicies {
@@ -152,7 +364,7 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 
 		if serviceRoles != nil {
 			for name, serviceRole := range serviceRoles {
-				k := fmt.Sprintf("%s_%d", account, i)
+				k := fmt.Sprintf("%s%s_%d", prefix, account, i)
 				i++
 
 				serviceRoleMap[fmt.Sprintf("%s_name", k)] = name
@@ -160,7 +372,7 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 				sp, err := json.MarshalIndent(serviceRole.Policy, "", "  ")
 
 				if err != nil {
-					return err
+					return nil, nil, nil, err
 				}
 
 				serviceRoleMap[fmt.Sprintf("%s_policy", k)] = string(sp)
@@ -168,19 +380,27 @@ func dataSourceAmperContainerRead(d *schema.ResourceData, meta interface{}) erro
 				sarp, err := json.MarshalIndent(serviceRole.AssumeRolePolicy, "", "  ")
 
 				if err != nil {
-					return err
+					return nil, nil, nil, err
 				}
 
 				serviceRoleMap[fmt.Sprintf("%s_assume_role_policy", k)] = string(sarp)
 			}
 		}
 
-		serviceRoleMap[fmt.Sprintf("%s_count", account)] = fmt.Sprintf("%d", len(serviceRoles))
+		serviceRoleMap[fmt.Sprintf("%s%s_count", prefix, account)] = fmt.Sprintf("%d", len(serviceRoles))
 	}
 
-	d.Set("service_role_policies", serviceRoleMap)
+	return policyMap, rolePolicyMap, serviceRoleMap, nil
+}
 
-	d.SetId(d.Get("name").(string))
+// guardrailNames returns comma-separated names of guardrail statements
+// of container, indexed by account name with given prefix.
+func guardrailNames(p *amper.Policy, prefix string) map[string]string {
+	res := make(map[string]string, len(p.Guardrails))
 
-	return nil
+	for account, names := range p.Guardrails {
+		res[prefix+account] = strings.Join(names, ",")
+	}
+
+	return res
 }
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+func dataSourceAmperPolicyPartial() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAmperPolicyPartialRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"template": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"format": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Description:  "Format of partial, when merged into policy, json (default), yaml, hcl or data",
+				ValidateFunc: validateTemplateFormat,
+			},
+		},
+	}
+}
+
+func dataSourceAmperPolicyPartialRead(d *schema.ResourceData, meta interface{}) error {
+	cc := meta.(*amper.Kernel)
+
+	p := &amper.Partial{
+		Name:     d.Get("name").(string),
+		Template: d.Get("template").(string),
+		Format:   d.Get("format").(string),
+	}
+
+	if err := cc.AddPartial(p); err != nil {
+		return err
+	}
+
+	d.SetId(p.Name)
+
+	return nil
+}
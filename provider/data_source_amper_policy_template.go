@@ -29,6 +29,34 @@ func dataSourceAmperPolicyTemplate() *schema.Resource {
 				Optional: true,
 				ForceNew: true,
 			},
+			"format": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Description:  "Format of rendered template, json (default), yaml, hcl or data",
+				ValidateFunc: validateTemplateFormat,
+			},
+			"version_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "Version of external template",
+				ConflictsWith: []string{"template"},
+			},
+			"sha256": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "Expected hex encoded SHA256 checksum of external template",
+				ConflictsWith: []string{"template"},
+			},
+			"require_signature": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "Require detached signature of external template",
+				ConflictsWith: []string{"template"},
+			},
 			"vars": {
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -36,6 +64,73 @@ func dataSourceAmperPolicyTemplate() *schema.Resource {
 				Elem:     &schema.Schema{Type: schema.TypeString},
 				Set:      schema.HashString,
 			},
+			"variable": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+						"type": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+							ValidateFunc: func(v interface{}, k string) ([]string, []error) {
+								switch v.(string) {
+								case amper.VarTypeString, amper.VarTypeList, amper.VarTypeMap, amper.VarTypeNumber, amper.VarTypeBool:
+								default:
+									return nil, []error{fmt.Errorf("type can be string, list, map, number or bool")}
+								}
+								return nil, nil
+							},
+						},
+						"description": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+						},
+						"default": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "Default value, lists and maps are JSON encoded, use defaults map for empty string",
+						},
+						"optional": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							ForceNew: true,
+						},
+						"pattern": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+						},
+						"enum": {
+							Type:     schema.TypeList,
+							Optional: true,
+							ForceNew: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+			"infer_vars": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Require all variables referenced in template",
+			},
+			"defaults": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Default values of variables",
+				Elem:        schema.TypeString,
+			},
 			"scope": {
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -43,6 +138,13 @@ func dataSourceAmperPolicyTemplate() *schema.Resource {
 				Elem:     &schema.Schema{Type: schema.TypeString},
 				Set:      schema.HashString,
 			},
+			"partials": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Names of partials, which statements are merged into policy",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
 			"service_role": {
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -129,6 +231,18 @@ func dataSourceAmperPolicyTemplateRead(d *schema.ResourceData, meta interface{})
 		pt.Template = aws.String(attr.(string))
 	}
 
+	pt.Format = d.Get("format").(string)
+
+	if attr, ok := d.GetOk("version_id"); ok {
+		pt.VersionID = attr.(string)
+	}
+
+	if attr, ok := d.GetOk("sha256"); ok {
+		pt.SHA256 = attr.(string)
+	}
+
+	pt.RequireSignature = d.Get("require_signature").(bool)
+
 	if attr := d.Get("vars").(*schema.Set); attr.Len() > 0 {
 		pt.Vars = make([]string, 0, attr.Len())
 
@@ -137,6 +251,37 @@ func dataSourceAmperPolicyTemplateRead(d *schema.ResourceData, meta interface{})
 		}
 	}
 
+	pt.InferVars = d.Get("infer_vars").(bool)
+
+	if attr, ok := d.GetOk("defaults"); ok {
+		pt.Defaults = make(map[string]string)
+
+		for k, v := range attr.(map[string]interface{}) {
+			pt.Defaults[k] = v.(string)
+		}
+	}
+
+	for _, raw := range d.Get("variable").(*schema.Set).List() {
+		l := raw.(map[string]interface{})
+
+		v := &amper.Variable{
+			Name:        l["name"].(string),
+			Type:        l["type"].(string),
+			Description: l["description"].(string),
+			Optional:    l["optional"].(bool),
+			Pattern:     l["pattern"].(string),
+			Enum:        resourceGetStringListFromList(l["enum"].([]interface{})),
+		}
+
+		// Empty string in nested block cannot be told apart from
+		// unset attribute, empty defaults are set with defaults map.
+		if def := l["default"].(string); def != "" {
+			v.Default = def
+		}
+
+		pt.Variables = append(pt.Variables, v)
+	}
+
 	if attr := d.Get("scope").(*schema.Set); attr.Len() > 0 {
 		pt.Scope = make([]string, 0, attr.Len())
 
@@ -145,6 +290,10 @@ func dataSourceAmperPolicyTemplateRead(d *schema.ResourceData, meta interface{})
 		}
 	}
 
+	if attr, ok := d.GetOk("partials"); ok {
+		pt.Partials = resourceGetStringListFromList(attr.([]interface{}))
+	}
+
 	d.SetId(d.Get("key").(string))
 
 	serviceRole := d.Get("service_role").(*schema.Set).List()
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"regexp"
 	"testing"
 
 	"github.com/hashicorp/terraform/helper/resource"
@@ -56,3 +57,66 @@ func TestPolicyTemplateConsts(t *testing.T) {
 		},
 	})
 }
+
+const testPolicyTemplateVariablesConfig = `
+data "amper_account" "test" {
+  account_id = "333333333333"
+  name       = "variables-prod"
+  short_name = "prod"
+}
+
+data "amper_policy_template" "test" {
+  key = "variables"
+
+  scope = ["sqs:*"]
+
+  template = <<EOF
+{"Statement":[{
+  "Sid": "Queues{{ .vars.suffix }}",
+  "Effect": "Allow",
+  "Action": "sqs:SendMessage",
+  "Resource": {{ jsonList .vars.queues }}
+}]}
+EOF
+
+  variable {
+    name = "queues"
+    type = "list"
+  }
+
+  defaults = {
+    suffix = ""
+  }
+}
+
+data "amper_container" "test" {
+  name = "variables"
+
+  attachment {
+    policy_template_id = "${data.amper_policy_template.test.id}"
+    account_name       = "${data.amper_account.test.name}"
+
+    vars = {
+      queues = "[\"q1\", \"q2\"]"
+    }
+  }
+}
+`
+
+func TestPolicyTemplateVariables(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]terraform.ResourceProvider{
+			"amper": testProvider,
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testPolicyTemplateVariablesConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.amper_container.test", "policies.variables-prod_count", "1"),
+					resource.TestMatchResourceAttr("data.amper_container.test", "policies.variables-prod_0", regexp.MustCompile(`"Sid": "Queues",`)),
+					resource.TestMatchResourceAttr("data.amper_container.test", "policies.variables-prod_0", regexp.MustCompile(`"q2"`)),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+func dataSourceAmperPolicyTemplates() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAmperPolicyTemplatesRead,
+
+		Schema: map[string]*schema.Schema{
+			"container_id": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateName,
+			},
+			"keys": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "IDs of discovered policy templates, key or <container>/<key>, if key is taken by other container",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func dataSourceAmperPolicyTemplatesRead(d *schema.ResourceData, meta interface{}) error {
+	cc := meta.(*amper.Kernel)
+
+	keys, err := cc.DiscoverPolicyTemplates(d.Get("container_id").(string))
+
+	if err != nil {
+		return err
+	}
+
+	d.SetId(d.Get("container_id").(string))
+
+	return d.Set("keys", keys)
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+// guardrailResource is schema of guardrail block of provider.
+func guardrailResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Name of guardrail, used as Sid of Deny statement",
+			},
+			"actions": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"not_actions": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"resources": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Denied resources, defaults to all resources",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"condition": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"test": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"variable": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"values": {
+							Type:     schema.TypeList,
+							Required: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// expandGuardrail converts guardrail block of provider into guardrail.
+func expandGuardrail(l map[string]interface{}) *amper.Guardrail {
+	g := &amper.Guardrail{
+		Name:       l["name"].(string),
+		Actions:    resourceGetStringListFromList(l["actions"].([]interface{})),
+		NotActions: resourceGetStringListFromList(l["not_actions"].([]interface{})),
+		Resources:  resourceGetStringListFromList(l["resources"].([]interface{})),
+	}
+
+	for _, raw := range l["condition"].([]interface{}) {
+		c := raw.(map[string]interface{})
+
+		if g.Conditions == nil {
+			g.Conditions = make(map[string]map[string]amper.StringList)
+		}
+
+		test := c["test"].(string)
+
+		if g.Conditions[test] == nil {
+			g.Conditions[test] = make(map[string]amper.StringList)
+		}
+
+		g.Conditions[test][c["variable"].(string)] = resourceGetStringListFromList(c["values"].([]interface{}))
+	}
+
+	return g
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
+	"github.com/mitchellh/go-homedir"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -70,10 +71,75 @@ func Provider() terraform.ResourceProvider {
 			},
 
 			"key_format": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "External policies key format",
+				Default:       "output/%s/policies/%s.json.tpl",
+				ValidateFunc:  validateKeyFormat,
+				ConflictsWith: []string{"key_formats"},
+			},
+
+			"key_formats": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				Description:   "Ordered list of external policies key formats, first found template is used",
+				Elem:          &schema.Schema{Type: schema.TypeString, ValidateFunc: validateKeyFormat},
+				ConflictsWith: []string{"key_format"},
+			},
+
+			"template_dir": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "Local directory with external policies",
+				ConflictsWith: []string{"state_bucket", "template_bundle"},
+			},
+
+			"template_bundle": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "Tar, tar.gz or zip archive with external policies",
+				ConflictsWith: []string{"state_bucket", "template_dir"},
+			},
+
+			"template_keyring": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "ASCII armored OpenPGP public keyring for verifying external policies",
+			},
+
+			"require_template_signature": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Require detached signature for all external policies",
+			},
+
+			"missing_key_error": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Fail rendering of templates referring to missing keys",
+			},
+
+			"sandbox_template_funcs": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Remove environment and non-deterministic functions from templates",
+			},
+
+			"role_name_format": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				Description: "External policies key format",
-				Default:     "output/%s/policies/%s.json.tpl",
+				Default:     amper.DefaultRoleNameFormat,
+				Description: "Format of container role name, used by roleArn template function",
+			},
+
+			"guardrail": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Deny statements added to policies of all containers, in given order",
+				Elem:        guardrailResource(),
 			},
 
 			"disable_aws": {
@@ -86,22 +152,68 @@ func Provider() terraform.ResourceProvider {
 					"profile",
 					"region",
 					"state_bucket",
-					"key_format",
 				},
 			},
 		},
 		DataSourcesMap: map[string]*schema.Resource{
-			"amper_account":         dataSourceAmperAccount(),
-			"amper_container":       dataSourceAmperContainer(),
-			"amper_policy_template": dataSourceAmperPolicyTemplate(),
-			"amper_fc":              dataSourceAmperFc(),
+			"amper_account":          dataSourceAmperAccount(),
+			"amper_accounts":         dataSourceAmperAccounts(),
+			"amper_account_group":    dataSourceAmperAccountGroup(),
+			"amper_container":        dataSourceAmperContainer(),
+			"amper_config":           dataSourceAmperConfig(),
+			"amper_policy_template":  dataSourceAmperPolicyTemplate(),
+			"amper_policy_partial":   dataSourceAmperPolicyPartial(),
+			"amper_policy_templates": dataSourceAmperPolicyTemplates(),
+			"amper_fc":               dataSourceAmperFc(),
 		},
 		ConfigureFunc: providerConfigure,
 	}
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	amperConfig := &amper.AmperConfig{}
+	amperConfig := &amper.AmperConfig{
+		KeyFormat:  d.Get("key_format").(string),
+		KeyFormats: resourceGetStringListFromList(d.Get("key_formats").([]interface{})),
+
+		RequireSignature: d.Get("require_template_signature").(bool),
+		MissingKeyError:  d.Get("missing_key_error").(bool),
+		SandboxFuncs:     d.Get("sandbox_template_funcs").(bool),
+		RoleNameFormat:   d.Get("role_name_format").(string),
+	}
+
+	for _, raw := range d.Get("guardrail").([]interface{}) {
+		amperConfig.Guardrails = append(amperConfig.Guardrails, expandGuardrail(raw.(map[string]interface{})))
+	}
+
+	if attr, ok := d.GetOk("template_keyring"); ok {
+		keyring, err := amper.ReadKeyring(attr.(string))
+
+		if err != nil {
+			return nil, err
+		}
+
+		amperConfig.Keyring = keyring
+	}
+
+	if attr, ok := d.GetOk("template_dir"); ok {
+		path, err := homedir.Expand(attr.(string))
+
+		if err != nil {
+			return nil, fmt.Errorf("Error expanding homedir in template_dir (%s): %s", attr, err)
+		}
+
+		amperConfig.TemplateSource = amper.NewDirTemplateSource(path)
+	} else if attr, ok := d.GetOk("template_bundle"); ok {
+		path, err := homedir.Expand(attr.(string))
+
+		if err != nil {
+			return nil, fmt.Errorf("Error expanding homedir in template_bundle (%s): %s", attr, err)
+		}
+
+		if amperConfig.TemplateSource, err = amper.NewBundleTemplateSource(path); err != nil {
+			return nil, err
+		}
+	}
 
 	if !d.Get("disable_aws").(bool) {
 		config := &tfaws.Config{
@@ -151,8 +263,7 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		}
 		amperConfig.S3 = s3.New(sess)
 		amperConfig.StateBucket = d.Get("state_bucket").(string)
-		amperConfig.KeyFormat = d.Get("key_format").(string)
 	}
 
-	return amper.NewKernel(amperConfig), nil
+	return amper.NewKernel(amperConfig)
 }
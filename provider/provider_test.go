@@ -1,7 +1,12 @@
 package provider
 
 import (
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 )
 
 var testProvider *schema.Provider
@@ -9,3 +14,93 @@ var testProvider *schema.Provider
 func init() {
 	testProvider = Provider().(*schema.Provider)
 }
+
+func TestProvider(t *testing.T) {
+	if err := testProvider.InternalValidate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProviderKeyFormats(t *testing.T) {
+	for _, test := range []struct {
+		raw   map[string]interface{}
+		valid bool
+	}{
+		{map[string]interface{}{"key_formats": []interface{}{"output/{container}/{key}.json.tpl"}}, true},
+		{map[string]interface{}{"key_formats": []interface{}{"output/{container}/policy.json.tpl"}}, false},
+		{map[string]interface{}{"key_format": "output/{container}/policy.json.tpl"}, false},
+	} {
+		raw, err := config.NewRawConfig(test.raw)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, errs := testProvider.Validate(terraform.NewResourceConfig(raw))
+
+		if (len(errs) == 0) != test.valid {
+			t.Fatalf("unexpected validation result of %v: %v", test.raw, errs)
+		}
+	}
+}
+
+const testProviderGuardrailsConfig = `
+provider "amper" {
+  guardrail {
+    name    = "DenyLeaveOrganization"
+    actions = ["organizations:LeaveOrganization"]
+  }
+}
+
+data "amper_account" "test" {
+  account_id = "444444444444"
+  name       = "guardrails-prod"
+  short_name = "prod"
+}
+
+data "amper_policy_template" "test" {
+  key   = "guardrails"
+  scope = ["s3:*"]
+
+  template = <<EOF
+{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}
+EOF
+}
+
+data "amper_container" "all" {
+  name = "guardrails-all"
+
+  attachment {
+    policy_template_id = "${data.amper_policy_template.test.id}"
+    account_name       = "${data.amper_account.test.name}"
+  }
+}
+
+data "amper_container" "excluded" {
+  name = "guardrails-excluded"
+
+  exclude_guardrails = ["DenyLeaveOrganization"]
+
+  attachment {
+    policy_template_id = "${data.amper_policy_template.test.id}"
+    account_name       = "${data.amper_account.test.name}"
+  }
+}
+`
+
+func TestProviderGuardrails(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]terraform.ResourceProvider{
+			"amper": testProvider,
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderGuardrailsConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.amper_container.all", "applied_guardrails.guardrails-prod", "DenyUnknownServices,DenyLeaveOrganization,AllowAll"),
+					resource.TestCheckResourceAttr("data.amper_container.excluded", "applied_guardrails.guardrails-prod", "DenyUnknownServices,AllowAll"),
+				),
+			},
+		},
+	})
+}
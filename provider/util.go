@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/spirius/terraform-provider-amper/amper"
 )
 
 var reservedWords = []string{
@@ -62,6 +64,35 @@ func validateName(v interface{}, k string) (ws []string, errors []error) {
 	return
 }
 
+// validatePolicyTemplateID validates key or qualified ID of policy
+// template, see amper.PolicyTemplateID.
+func validatePolicyTemplateID(v interface{}, k string) (ws []string, errors []error) {
+	parts := strings.SplitN(v.(string), "/", 2)
+
+	if len(parts) == 1 {
+		return validateName(parts[0], k)
+	}
+
+	ws, errors = validateContainerName(parts[0], k)
+	kws, kerrors := validateName(parts[1], k)
+
+	return append(ws, kws...), append(errors, kerrors...)
+}
+
+func validateKeyFormat(v interface{}, k string) (ws []string, errors []error) {
+	if err := amper.ValidateKeyFormat(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+	}
+	return
+}
+
+func validateTemplateFormat(v interface{}, k string) (ws []string, errors []error) {
+	if err := amper.ValidateTemplateFormat(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+	}
+	return
+}
+
 func resourceGetStringListFromList(attrs []interface{}) (res []string) {
 	res = make([]string, 0, len(attrs))
 
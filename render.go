@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+const renderUsage = `Usage: terraform-provider-amper render [options] -config FILE
+
+  Renders policies of all containers declared in YAML or JSON config
+  and writes them to <out>/<account>.json, indexed by container ID.
+
+Options:
+`
+
+// render is the standalone mode, which renders policies without terraform.
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+
+	var (
+		config         = fs.String("config", "", "config `file` with accounts, containers and templates")
+		out            = fs.String("out", "policies", "output `directory`")
+		templateDir    = fs.String("template-dir", "", "load templates from `directory`, instead of config")
+		templateBundle = fs.String("template-bundle", "", "load templates from zip or tar `archive`, instead of config")
+	)
+
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, renderUsage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if *config == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("invalid arguments")
+	}
+
+	if *templateDir != "" && *templateBundle != "" {
+		return fmt.Errorf("-template-dir and -template-bundle cannot be used together")
+	}
+
+	cfg, err := amper.LoadConfig(*config)
+
+	if err != nil {
+		return err
+	}
+
+	if *templateDir != "" {
+		cfg.TemplateSource = amper.NewDirTemplateSource(*templateDir)
+	} else if *templateBundle != "" {
+		if cfg.TemplateSource, err = amper.NewBundleTemplateSource(*templateBundle); err != nil {
+			return err
+		}
+	}
+
+	k, err := cfg.NewKernel()
+
+	if err != nil {
+		return err
+	}
+
+	accounts, warnings, err := k.RenderAccounts()
+
+	if err != nil {
+		return err
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "[WARN] %s\n", w)
+	}
+
+	files, err := writeAccounts(*out, accounts)
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fmt.Println(file)
+	}
+
+	return nil
+}
+
+// writeAccounts writes policies of accounts to <out>/<account>.json
+// and returns written files in order of account names.
+func writeAccounts(out string, accounts map[string]map[string]*amper.ContainerPolicies) ([]string, error) {
+	names := make([]string, 0, len(accounts))
+
+	for name := range accounts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// Account names are used as file names, so they
+	// must not point outside of output directory.
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+			return nil, fmt.Errorf("cannot write policies of account '%s', name is not valid file name", name)
+		}
+	}
+
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(names))
+
+	for _, name := range names {
+		data, err := json.MarshalIndent(accounts[name], "", "  ")
+
+		if err != nil {
+			return nil, err
+		}
+
+		file := filepath.Join(out, name+".json")
+
+		if err = ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
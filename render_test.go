@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spirius/terraform-provider-amper/amper"
+)
+
+const testRenderConfig = `
+accounts:
+  - {id: "111111111111", name: prod}
+  - {id: "222222222222", name: dev}
+containers:
+  - id: app
+    policy_templates:
+      - key: app
+        scope: ["s3:*"]
+        template: '{"Statement": [{"Sid": "Get", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}'
+    attachments:
+      - {policy_template: app, account: "*"}
+`
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "amper.yaml")
+
+	if err = ioutil.WriteFile(config, []byte(testRenderConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out")
+
+	if err = render([]string{"-config", config, "-out", out}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, account := range []string{"prod", "dev"} {
+		data, err := ioutil.ReadFile(filepath.Join(out, account+".json"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var policies map[string]*amper.ContainerPolicies
+
+		if err = json.Unmarshal(data, &policies); err != nil {
+			t.Fatal(err)
+		}
+
+		if cp := policies["app"]; cp == nil || cp.Policies[0].Statements[0].Sid != "Get" {
+			t.Fatalf("unexpected policies of account '%s': %s", account, data)
+		}
+	}
+
+	if err = render([]string{"-out", out}); err == nil {
+		t.Fatal("expected error for missing config")
+	}
+
+	if err = render([]string{"-h"}); err != nil {
+		t.Fatalf("expected help to succeed, got %s", err)
+	}
+}
+
+func TestWriteAccountsInvalidNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amper")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+
+	for _, name := range []string{"../escape", "a/b", `a\b`, "..", ""} {
+		files, err := writeAccounts(out, map[string]map[string]*amper.ContainerPolicies{name: {}})
+
+		if err == nil || !strings.Contains(err.Error(), "not valid file name") {
+			t.Fatalf("expected invalid name error for '%s', got %v, %v", name, files, err)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "escape.json")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be written outside of output directory")
+	}
+}